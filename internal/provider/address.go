@@ -0,0 +1,237 @@
+package provider
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// callAddress is where a call is dialed, the :authority it is sent with and its method path
+type callAddress struct {
+	Target    string
+	Dial      *dialTarget
+	Authority string
+	Path      string
+}
+
+// url is the call as the server sees it; the transport connects to Dial instead of its host
+func (a *callAddress) url() string {
+	return "https://" + a.Authority + a.Path
+}
+
+// serverName is the default sni, the authority without its port
+func (a *callAddress) serverName() string {
+	if host, _, err := net.SplitHostPort(a.Authority); err == nil {
+		return host
+	}
+	return strings.Trim(a.Authority, "[]")
+}
+
+// resolveAddresses reads url, or service and method on an endpoint or target, and
+// applies the target, targets and authority overrides of the data source; there
+// is one address per target, in the order they are tried
+func resolveAddresses(d *schema.ResourceData, baseURL string, endpoint *endpointConfig, named bool) ([]*callAddress, diag.Diagnostics) {
+	a := &callAddress{}
+	if rawURL := d.Get("url").(string); rawURL != "" {
+		resolved, err := resolveURL(baseURL, rawURL)
+		if err != nil {
+			return nil, diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       "Error resolving url",
+				Detail:        err.Error(),
+				AttributePath: cty.GetAttrPath("url"),
+			}}
+		}
+		u, err := url.Parse(resolved)
+		if err == nil {
+			a.Target, err = urlAddr(resolved)
+		}
+		if err != nil {
+			return nil, diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       "Invalid url",
+				Detail:        err.Error(),
+				AttributePath: cty.GetAttrPath("url"),
+			}}
+		}
+		a.Authority, a.Path = u.Host, u.EscapedPath()
+	} else {
+		path, err := methodPath(d.Get("service").(string), d.Get("method").(string))
+		if err != nil {
+			return nil, diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       "Invalid method",
+				Detail:        err.Error(),
+				AttributePath: cty.GetAttrPath("method"),
+			}}
+		}
+		a.Path = path
+		if named {
+			a.Target, a.Authority = endpoint.Target, endpoint.Authority
+		}
+	}
+
+	if v := d.Get("target").(string); v != "" {
+		a.Target = v
+	}
+	if v := d.Get("authority").(string); v != "" {
+		a.Authority = v
+	}
+	targets := []string{a.Target}
+	if v := d.Get("targets").([]interface{}); len(v) > 0 {
+		targets = targets[:0]
+		for _, t := range v {
+			targets = append(targets, t.(string))
+		}
+	}
+	if targets[0] == "" {
+		return nil, diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Missing target",
+			Detail:        "method needs an endpoint or a target to connect to",
+			AttributePath: cty.GetAttrPath("target"),
+		}}
+	}
+
+	var proxy *url.URL
+	rawProxy := endpoint.Proxy
+	if v := d.Get("proxy").(string); v != "" {
+		rawProxy = v
+	}
+	if rawProxy != "" {
+		var err error
+		if proxy, err = parseProxy(rawProxy); err != nil {
+			return nil, diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       "Invalid proxy",
+				Detail:        err.Error(),
+				AttributePath: cty.GetAttrPath("proxy"),
+			}}
+		}
+	}
+	proxyCA := endpoint.ProxyCA
+	if v := d.Get("proxy_ca").(string); v != "" {
+		proxyCA = v
+	}
+	if _, err := proxyTLSConfig(proxyCA); err != nil {
+		return nil, diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid proxy_ca",
+			Detail:        err.Error(),
+			AttributePath: cty.GetAttrPath("proxy_ca"),
+		}}
+	}
+	resolve := mergeResolve(endpoint.Resolve, d.Get("resolve").(map[string]interface{}))
+
+	addresses := make([]*callAddress, 0, len(targets))
+	for i, raw := range targets {
+		target, err := parseTarget(raw)
+		if err == nil {
+			target, err = target.withResolve(resolve)
+		}
+		if err != nil {
+			path := cty.GetAttrPath("target")
+			if len(targets) > 1 {
+				path = cty.GetAttrPath("targets").IndexInt(i)
+			}
+			return nil, diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       "Invalid target",
+				Detail:        err.Error(),
+				AttributePath: path,
+			}}
+		}
+		target.proxy, target.proxyCA = proxy, proxyCA
+		address := *a
+		address.Target, address.Dial = raw, target
+		if address.Authority == "" {
+			address.Authority = target.authority
+		}
+		addresses = append(addresses, &address)
+	}
+	return addresses, nil
+}
+
+// methodPath joins service and method into /package.Service/Method
+func methodPath(service, method string) (string, error) {
+	if service != "" {
+		if strings.Contains(method, "/") {
+			return "", fmt.Errorf("method %q must be only the method name when service is set", method)
+		}
+		method = strings.Trim(service, "/") + "/" + method
+	}
+	path := "/" + strings.TrimPrefix(method, "/")
+	return path, checkMethodPath(path)
+}
+
+// checkMethodPath checks path is a gRPC method path like /echo.EchoServer/SayHello
+func checkMethodPath(path string) error {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if !strings.HasPrefix(path, "/") || len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.ContainsAny(path, " ?#%") {
+		return fmt.Errorf("%q is not a method path like \"/echo.EchoServer/SayHello\"", path)
+	}
+	return nil
+}
+
+// validateTarget checks a dial address is host:port or a gRPC naming target
+func validateTarget(v interface{}, path cty.Path) diag.Diagnostics {
+	target, ok := v.(string)
+	if !ok || target == "" {
+		return nil
+	}
+	if _, err := parseTarget(target); err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid target",
+			Detail:        err.Error(),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
+
+// validateResolve checks the resolve keys are host:port and the values IP addresses
+func validateResolve(v interface{}, path cty.Path) diag.Diagnostics {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var diags diag.Diagnostics
+	for hostport, ips := range m {
+		_, err := resolveIPs(ips.(string))
+		if _, _, splitErr := net.SplitHostPort(hostport); splitErr != nil {
+			err = fmt.Errorf("%q must be host:port", hostport)
+		}
+		if err != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "Invalid resolve",
+				Detail:        err.Error(),
+				AttributePath: path.IndexString(hostport),
+			})
+		}
+	}
+	return diags
+}
+
+// validateService checks service is a fully qualified service name, eg echo.EchoServer
+func validateService(v interface{}, path cty.Path) diag.Diagnostics {
+	service, ok := v.(string)
+	if !ok || service == "" {
+		return nil
+	}
+	if strings.ContainsAny(strings.Trim(service, "/"), "/ ?#%") {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid service",
+			Detail:        fmt.Sprintf("%q is not a service like \"echo.EchoServer\"", service),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestMethodPath(t *testing.T) {
+	tests := []struct {
+		service, method, want, wantErr string
+	}{
+		{"", "echo.EchoServer/SayHello", "/echo.EchoServer/SayHello", ""},
+		{"", "/echo.EchoServer/SayHello", "/echo.EchoServer/SayHello", ""},
+		{"echo.EchoServer", "SayHello", "/echo.EchoServer/SayHello", ""},
+		{"/echo.EchoServer/", "SayHello", "/echo.EchoServer/SayHello", ""},
+		{"", "SayHello", "", "is not a method path"},
+		{"echo.EchoServer", "echo.EchoServer/SayHello", "", "must be only the method name"},
+		{"echo.EchoServer", "", "", "is not a method path"},
+	}
+	for _, tc := range tests {
+		got, err := methodPath(tc.service, tc.method)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("methodPath(%q, %q) error = %v, want %q", tc.service, tc.method, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("methodPath(%q, %q) = %q, %v, want %q", tc.service, tc.method, got, err, tc.want)
+		}
+	}
+}
+
+func TestCallAddress(t *testing.T) {
+	a := &callAddress{Target: "127.0.0.1:8443", Authority: "billing.internal", Path: "/billing.Ledger/Post"}
+	if a.url() != "https://billing.internal/billing.Ledger/Post" {
+		t.Errorf("url = %q", a.url())
+	}
+	for authority, want := range map[string]string{
+		"billing.internal":     "billing.internal",
+		"billing.internal:443": "billing.internal",
+		"[::1]:8443":           "::1",
+		"[::1]":                "::1",
+	} {
+		a.Authority = authority
+		if got := a.serverName(); got != want {
+			t.Errorf("serverName() for %q = %q, want %q", authority, got, want)
+		}
+	}
+}
+
+func TestValidateTarget(t *testing.T) {
+	for _, target := range []string{"localhost:50051", "[::1]:443", "10.0.0.1:8443"} {
+		if diags := validateTarget(target, nil); diags.HasError() {
+			t.Errorf("validateTarget(%q): %v", target, diags)
+		}
+	}
+	for _, target := range []string{"localhost", "https://localhost:443", "localhost:443/echo", "localhost:"} {
+		if diags := validateTarget(target, nil); !diags.HasError() {
+			t.Errorf("validateTarget(%q): expected an error", target)
+		}
+	}
+}
+
+func TestResolveAddressesURLPath(t *testing.T) {
+	// a url path is sent as written, eg behind an ingress that routes on a prefix
+	raw := map[string]interface{}{"url": "https://localhost:8081/grpc/echo.EchoServer/SayHello"}
+	addresses, diags := resolveAddresses(schema.TestResourceDataRaw(t, dataSource().Schema, raw), "", &endpointConfig{}, false)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	if addresses[0].Path != "/grpc/echo.EchoServer/SayHello" || addresses[0].Target != "localhost:8081" {
+		t.Errorf("address = %+v", addresses[0])
+	}
+}
+
+func TestResolveAddressesProxyCA(t *testing.T) {
+	endpoint := &endpointConfig{Target: "billing.internal:443", ProxyCA: strings.Replace(caCert, `\n`, "\n", -1)}
+	raw := map[string]interface{}{"endpoint": "billing", "method": "billing.Ledger/Post"}
+	addresses, diags := resolveAddresses(schema.TestResourceDataRaw(t, dataSource().Schema, raw), "", endpoint, true)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	if addresses[0].Dial.proxyCA != endpoint.ProxyCA {
+		t.Error("endpoint proxy_ca not used")
+	}
+
+	raw["proxy_ca"] = "not a certificate"
+	_, diags = resolveAddresses(schema.TestResourceDataRaw(t, dataSource().Schema, raw), "", endpoint, true)
+	if !diags.HasError() || diags[0].Summary != "Invalid proxy_ca" {
+		t.Errorf("got %v for a data source proxy_ca without PEM", diags)
+	}
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	policyPickFirst  = "pick_first"
+	policyRoundRobin = "round_robin"
+)
+
+var loadBalancingPolicies = []string{policyPickFirst, policyRoundRobin}
+
+// targetBalancer remembers where each list of targets starts for round_robin,
+// for the lifetime of the provider
+type targetBalancer struct {
+	mu   sync.Mutex
+	next map[string]int
+}
+
+func newTargetBalancer() *targetBalancer {
+	return &targetBalancer{next: map[string]int{}}
+}
+
+// order is the order the addresses are tried in for one call; pick_first always
+// starts at the first, round_robin starts one further than the previous call did
+func (b *targetBalancer) order(policy string, addresses []*callAddress) []int {
+	start := 0
+	if policy == policyRoundRobin && len(addresses) > 1 {
+		targets := make([]string, 0, len(addresses))
+		for _, a := range addresses {
+			targets = append(targets, a.Target)
+		}
+		key := strings.Join(targets, ",")
+		b.mu.Lock()
+		start = b.next[key] % len(addresses)
+		b.next[key] = start + 1
+		b.mu.Unlock()
+	}
+	order := make([]int, len(addresses))
+	for i := range order {
+		order[i] = (start + i) % len(addresses)
+	}
+	return order
+}
+
+// callWithFailover calls the addresses in order until one answers with anything
+// but a connection failure or a status retry treats as retryable; it returns
+// the index of the address that answered
+func callWithFailover(ctx context.Context, retry *retryConfig, addresses []*callAddress, order []int, call func(*callAddress) (*grpcResponse, error)) (*grpcResponse, int, error) {
+	if retry == nil {
+		retry = &retryConfig{RetryableStatusCodes: []string{grpcCodeName(codes.Unavailable)}}
+	}
+	var failed []string
+	for n, i := range order {
+		resp, err := call(addresses[i])
+		if err == nil || !retry.retryable(err) {
+			return resp, i, err
+		}
+		if n == len(order)-1 || ctx.Err() != nil {
+			if len(failed) == 0 {
+				return nil, i, err
+			}
+			return nil, i, fmt.Errorf("every target failed, %s; %s: %w", strings.Join(failed, "; "), addresses[i].Target, err)
+		}
+		failed = append(failed, fmt.Sprintf("%s: %s", addresses[i].Target, err))
+		log.Printf("[INFO] grpc call to %s failed, failing over to %s: %s", addresses[i].Target, addresses[order[n+1]].Target, err)
+	}
+	return nil, -1, fmt.Errorf("no targets")
+}
@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func testAddresses(targets ...string) []*callAddress {
+	addresses := make([]*callAddress, 0, len(targets))
+	for _, t := range targets {
+		addresses = append(addresses, &callAddress{Target: t})
+	}
+	return addresses
+}
+
+func TestTargetBalancerOrder(t *testing.T) {
+	b := newTargetBalancer()
+	regional := testAddresses("us-east1:443", "us-west1:443", "eu-west1:443")
+	for i := 0; i < 3; i++ {
+		if got := fmt.Sprint(b.order(policyPickFirst, regional)); got != "[0 1 2]" {
+			t.Errorf("pick_first order = %s", got)
+		}
+	}
+	for _, want := range []string{"[0 1 2]", "[1 2 0]", "[2 0 1]", "[0 1 2]"} {
+		if got := fmt.Sprint(b.order(policyRoundRobin, regional)); got != want {
+			t.Errorf("round_robin order = %s, want %s", got, want)
+		}
+	}
+	// every list of targets rotates on its own
+	if got := fmt.Sprint(b.order(policyRoundRobin, testAddresses("a:443", "b:443"))); got != "[0 1]" {
+		t.Errorf("round_robin order of another list = %s", got)
+	}
+}
+
+func TestCallWithFailover(t *testing.T) {
+	addresses := testAddresses("a:443", "b:443", "c:443")
+	results := map[string]error{
+		"a:443": &transportError{err: errors.New("connection refused")},
+		"b:443": &grpcStatusError{Code: codes.Unavailable, Message: "draining"},
+		"c:443": nil,
+	}
+	var called []string
+	call := func(a *callAddress) (*grpcResponse, error) {
+		called = append(called, a.Target)
+		if err := results[a.Target]; err != nil {
+			return nil, err
+		}
+		return &grpcResponse{}, nil
+	}
+
+	resp, i, err := callWithFailover(context.Background(), nil, addresses, []int{0, 1, 2}, call)
+	if err != nil || resp == nil || i != 2 || strings.Join(called, ",") != "a:443,b:443,c:443" {
+		t.Errorf("failover = %v, %d, %v after calling %v", resp, i, err, called)
+	}
+
+	// a status that is not retryable is the answer
+	called = nil
+	results["b:443"] = &grpcStatusError{Code: codes.NotFound, Message: "no such ledger"}
+	_, i, err = callWithFailover(context.Background(), nil, addresses, []int{1, 2, 0}, call)
+	var statusErr *grpcStatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != codes.NotFound || i != 1 || len(called) != 1 {
+		t.Errorf("failover on NOT_FOUND = %d, %v after calling %v", i, err, called)
+	}
+	retry := &retryConfig{RetryableStatusCodes: []string{"UNAVAILABLE", "NOT_FOUND"}}
+	if _, i, err := callWithFailover(context.Background(), retry, addresses, []int{1, 2, 0}, call); err != nil || i != 2 {
+		t.Errorf("failover with NOT_FOUND retryable = %d, %v", i, err)
+	}
+
+	// when every target fails the error names each and keeps the last status
+	results["c:443"] = &grpcStatusError{Code: codes.Unavailable, Message: "down"}
+	results["b:443"] = &transportError{err: errors.New("timeout")}
+	_, _, err = callWithFailover(context.Background(), nil, addresses, []int{0, 1, 2}, call)
+	if err == nil || !strings.Contains(err.Error(), "a:443: connection refused") || !strings.Contains(err.Error(), "b:443: timeout") || !errors.As(err, &statusErr) || statusErr.Message != "down" {
+		t.Errorf("got error %v when every target fails", err)
+	}
+}
@@ -0,0 +1,251 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/psanford/lencode"
+	"google.golang.org/grpc/codes"
+)
+
+// grpcCodeNames are the canonical status code names, indexed by code
+var grpcCodeNames = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND",
+	"ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION",
+	"ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+func grpcCodeName(c codes.Code) string {
+	if int(c) < len(grpcCodeNames) {
+		return grpcCodeNames[c]
+	}
+	return c.String()
+}
+
+// grpcStatusError is a non OK grpc-status sent by the server
+type grpcStatusError struct {
+	Code    codes.Code
+	Message string
+}
+
+func (e *grpcStatusError) Error() string {
+	return fmt.Sprintf("grpc-status %s: %s", grpcCodeName(e.Code), e.Message)
+}
+
+// transportError is a failure to reach the server or an http level error
+type transportError struct {
+	err error
+	// httpStatus is the status of a response without grpc, 0 when no response was read
+	httpStatus int
+}
+
+func (e *transportError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+// grpcResponse is the outcome of one unary call
+type grpcResponse struct {
+	StatusCode int
+	Header     http.Header
+	Message    []byte
+	Conn       *connectionInfo
+}
+
+// doCall frames in, posts it to url with authority as :authority and returns the unframed response message
+func doCall(ctx context.Context, client *http.Client, url string, authority string, headers map[string]string, in []byte, signer requestSigner, limits messageLimits) (*grpcResponse, error) {
+	if err := limits.checkSend(in); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	enc := lencode.NewEncoder(&out, lencode.SeparatorOpt([]byte{0}))
+	err := enc.Encode(in)
+	if err != nil {
+		return nil, fmt.Errorf("Error lencoding request: %s", err)
+	}
+
+	conn := &connectionInfo{}
+	req, err := http.NewRequestWithContext(withConnectionTrace(ctx, conn), http.MethodPost, url, bytes.NewReader(out.Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("Error creating http client: %s", err)
+	}
+	if authority != "" {
+		// the transport dials the url host, the server routes on :authority
+		req.Host = authority
+	}
+	req.Header.Set("content-type", "application/grpc")
+	req.Header.Set("te", "trailers")
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	// signed last so the signature covers exactly the framed bytes and metadata that are sent
+	if signer != nil {
+		sent := make(map[string]string, len(req.Header))
+		for name := range req.Header {
+			sent[strings.ToLower(name)] = req.Header.Get(name)
+		}
+		md, err := signer.sign(&signingRequest{
+			Method:    req.Method,
+			Authority: authorityOf(req),
+			Path:      req.URL.RequestURI(),
+			Headers:   sent,
+			Body:      out.Bytes(),
+			Time:      time.Now(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Error signing request: %s", err)
+		}
+		for name, value := range md {
+			req.Header.Set(name, value)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &transportError{err: fmt.Errorf("Error creating grpcCall: %s", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &transportError{err: fmt.Errorf("Error grpcCall status !=StatusOK  got: %s", resp.Status), httpStatus: resp.StatusCode}
+	}
+	// decoded message by message, an oversized one fails on its prefix before it is buffered
+	var respMessageBytes []byte
+	found := false
+	for {
+		msg, err := readMessage(resp.Body, limits.receive())
+		if err == io.EOF {
+			break
+		}
+		var statusErr *grpcStatusError
+		if errors.As(err, &statusErr) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, &transportError{err: fmt.Errorf("Error reading HTTP response body: %s", err)}
+		}
+		// a unary response has one message, the body is still read to the end for the trailers
+		if !found {
+			respMessageBytes, found = msg, true
+		}
+	}
+
+	// the status is in the trailers, or in the headers for a trailers-only response
+	if err := responseStatus(resp); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("Error reading respMessageBytes: the response has no message")
+	}
+
+	return &grpcResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Message:    respMessageBytes,
+		Conn:       conn,
+	}, nil
+}
+
+// authorityOf is the :authority a request is sent with
+func authorityOf(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+func responseStatus(resp *http.Response) error {
+	st := resp.Trailer.Get("grpc-status")
+	msg := resp.Trailer.Get("grpc-message")
+	if st == "" {
+		st = resp.Header.Get("grpc-status")
+		msg = resp.Header.Get("grpc-message")
+	}
+	if st == "" || st == "0" {
+		return nil
+	}
+	code, err := strconv.ParseUint(st, 10, 32)
+	if err != nil {
+		return fmt.Errorf("Error parsing grpc-status %q: %s", st, err)
+	}
+	// grpc-message is percent encoded
+	if unescaped, err := url.PathUnescape(msg); err == nil {
+		msg = unescaped
+	}
+	return &grpcStatusError{Code: codes.Code(code), Message: msg}
+}
+
+// retryConfig is the retry block of an endpoint
+type retryConfig struct {
+	MaxAttempts          int
+	InitialBackoffMS     int
+	MaxBackoffMS         int
+	RetryableStatusCodes []string
+}
+
+// retryable reports whether a failed attempt may be sent again
+func (r *retryConfig) retryable(err error) bool {
+	code := codes.Unavailable
+	var statusErr *grpcStatusError
+	var transportErr *transportError
+	switch {
+	case errors.As(err, &statusErr):
+		code = statusErr.Code
+	case errors.As(err, &transportErr):
+		// the server was not reached or a gateway could not reach it, treat it as unavailable;
+		// any other http status is a permanent failure
+		switch transportErr.httpStatus {
+		case 0, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+	for _, name := range r.RetryableStatusCodes {
+		if name == grpcCodeName(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// callWithRetry runs call until it succeeds, fails with a status that is not
+// retryable or runs out of attempts, backing off exponentially in between
+func callWithRetry(ctx context.Context, retry *retryConfig, call func() (*grpcResponse, error)) (*grpcResponse, error) {
+	if retry == nil || retry.MaxAttempts < 2 {
+		return call()
+	}
+	backoff := time.Duration(retry.InitialBackoffMS) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		resp, err := call()
+		if err == nil || attempt >= retry.MaxAttempts || !retry.retryable(err) {
+			return resp, err
+		}
+		log.Printf("[INFO] grpc call attempt %d of %d failed, retrying in %s: %s", attempt, retry.MaxAttempts, backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if max := time.Duration(retry.MaxBackoffMS) * time.Millisecond; backoff > max {
+			backoff = max
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestCallWithRetry(t *testing.T) {
+	retry := &retryConfig{
+		MaxAttempts:          3,
+		RetryableStatusCodes: []string{"UNAVAILABLE"},
+	}
+
+	tests := []struct {
+		name    string
+		errs    []error
+		wantErr bool
+		calls   int
+	}{
+		{"success", nil, false, 1},
+		{"retried", []error{&grpcStatusError{Code: codes.Unavailable}, &transportError{err: errors.New("connection refused")}}, false, 3},
+		{"exhausted", []error{&grpcStatusError{Code: codes.Unavailable}, &grpcStatusError{Code: codes.Unavailable}, &grpcStatusError{Code: codes.Unavailable}}, true, 3},
+		{"not retryable", []error{&grpcStatusError{Code: codes.InvalidArgument}}, true, 1},
+		{"gateway", []error{&transportError{err: errors.New("503 Service Unavailable"), httpStatus: 503}}, false, 2},
+		{"http status", []error{&transportError{err: errors.New("404 Not Found"), httpStatus: 404}}, true, 1},
+		{"decode error", []error{errors.New("Error reading respMessageBytes")}, true, 1},
+	}
+	for _, tc := range tests {
+		calls := 0
+		_, err := callWithRetry(context.Background(), retry, func() (*grpcResponse, error) {
+			calls++
+			if calls <= len(tc.errs) {
+				return nil, tc.errs[calls-1]
+			}
+			return &grpcResponse{}, nil
+		})
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if calls != tc.calls {
+			t.Errorf("%s: %d calls, want %d", tc.name, calls, tc.calls)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"net"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// connectionSchema is the computed connection_info attribute of a data source
+func connectionSchema() *schema.Schema {
+	computedString := &schema.Schema{Type: schema.TypeString, Computed: true}
+	computedStrings := &schema.Schema{Type: schema.TypeList, Computed: true, Elem: &schema.Schema{Type: schema.TypeString}}
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Computed:    true,
+		Description: "The connection the call was sent on.",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"remote_ip":     computedString,
+				"remote_port":   {Type: schema.TypeInt, Computed: true},
+				"reused":        {Type: schema.TypeBool, Computed: true},
+				"tls_version":   computedString,
+				"cipher_suite":  computedString,
+				"alpn_protocol": computedString,
+				"server_name":   computedString,
+				"server_certificates": {
+					Type:        schema.TypeList,
+					Computed:    true,
+					Description: "The chain the server sent, leaf first.",
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"subject":            computedString,
+							"issuer":             computedString,
+							"serial_number":      computedString,
+							"dns_names":          computedStrings,
+							"ip_addresses":       computedStrings,
+							"uris":               computedStrings,
+							"email_addresses":    computedStrings,
+							"not_before":         computedString,
+							"not_after":          computedString,
+							"sha256_fingerprint": computedString,
+							"pem":                computedString,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// connectionInfo is what the transport reported about the connection of a call
+type connectionInfo struct {
+	mu     sync.Mutex
+	remote net.Addr
+	reused bool
+	state  *tls.ConnectionState
+}
+
+// withConnectionTrace returns a context that records the connection a request gets into info
+func withConnectionTrace(ctx context.Context, info *connectionInfo) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(c httptrace.GotConnInfo) {
+			info.mu.Lock()
+			defer info.mu.Unlock()
+			info.remote = c.Conn.RemoteAddr()
+			info.reused = c.Reused
+			if tc, ok := c.Conn.(*tls.Conn); ok {
+				st := tc.ConnectionState()
+				info.state = &st
+			}
+		},
+	})
+}
+
+// flatten is the value of the connection_info attribute, empty when no connection was reported
+func (c *connectionInfo) flatten() []interface{} {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.remote == nil {
+		return nil
+	}
+
+	m := map[string]interface{}{
+		"remote_ip": c.remote.String(),
+		"reused":    c.reused,
+	}
+	if host, port, err := net.SplitHostPort(c.remote.String()); err == nil {
+		m["remote_ip"] = host
+		m["remote_port"], _ = strconv.Atoi(port)
+	}
+	if st := c.state; st != nil {
+		m["tls_version"] = tls.VersionName(st.Version)
+		m["cipher_suite"] = tls.CipherSuiteName(st.CipherSuite)
+		m["alpn_protocol"] = st.NegotiatedProtocol
+		m["server_name"] = st.ServerName
+		var certs []interface{}
+		for _, cert := range st.PeerCertificates {
+			certs = append(certs, flattenCertificate(cert))
+		}
+		m["server_certificates"] = certs
+	}
+	return []interface{}{m}
+}
+
+func flattenCertificate(cert *x509.Certificate) map[string]interface{} {
+	sum := sha256.Sum256(cert.Raw)
+	var ips, uris []string
+	for _, ip := range cert.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	for _, u := range cert.URIs {
+		uris = append(uris, u.String())
+	}
+	return map[string]interface{}{
+		"subject":            cert.Subject.String(),
+		"issuer":             cert.Issuer.String(),
+		"serial_number":      cert.SerialNumber.String(),
+		"dns_names":          cert.DNSNames,
+		"ip_addresses":       ips,
+		"uris":               uris,
+		"email_addresses":    cert.EmailAddresses,
+		"not_before":         cert.NotBefore.UTC().Format(time.RFC3339),
+		"not_after":          cert.NotAfter.UTC().Format(time.RFC3339),
+		"sha256_fingerprint": hex.EncodeToString(sum[:]),
+		"pem":                string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})),
+	}
+}
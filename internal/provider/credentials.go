@@ -0,0 +1,494 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenTypeAccessToken       = "urn:ietf:params:oauth:token-type:access_token"
+
+	authStyleHeader = "header"
+	authStyleParams = "params"
+
+	// tokens are refreshed this long before they expire, or halfway for short lived tokens
+	tokenRefreshWindow = time.Minute
+	// tokens without an expiry are fetched again after this long
+	defaultTokenLifetime = time.Hour
+
+	defaultTokenTimeout = 30 * time.Second
+)
+
+// withTokenEndpointSchema adds the attributes of the connection to token_url to s
+func withTokenEndpointSchema(s map[string]*schema.Schema) map[string]*schema.Schema {
+	s["ca"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Optional:    true,
+		Description: "PEM encoded CA certificates trusted for token_url instead of the system roots.",
+	}
+	s["timeout_ms"] = &schema.Schema{
+		Type:         schema.TypeInt,
+		Optional:     true,
+		Default:      int(defaultTokenTimeout / time.Millisecond),
+		ValidateFunc: validation.IntAtLeast(1),
+		Description:  "Timeout of a token request, including reading the response.",
+	}
+	return s
+}
+
+// credentialsSchema is the credentials block of the provider, an endpoint or a data source
+func credentialsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"client_credentials": {
+					Type:     schema.TypeList,
+					Optional: true,
+					MaxItems: 1,
+					Elem: &schema.Resource{
+						Schema: withTokenEndpointSchema(map[string]*schema.Schema{
+							"token_url": {
+								Type:     schema.TypeString,
+								Required: true,
+							},
+							"client_id": {
+								Type:     schema.TypeString,
+								Required: true,
+							},
+							"client_secret": {
+								Type:      schema.TypeString,
+								Required:  true,
+								Sensitive: true,
+							},
+							"scopes": {
+								Type:     schema.TypeList,
+								Optional: true,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+							"audience": {
+								Type:     schema.TypeString,
+								Optional: true,
+							},
+							"endpoint_params": {
+								Type:     schema.TypeMap,
+								Optional: true,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+								Description: "Extra form parameters sent to token_url.",
+							},
+							"auth_style": {
+								Type:         schema.TypeString,
+								Optional:     true,
+								Default:      authStyleHeader,
+								ValidateFunc: validation.StringInSlice([]string{authStyleHeader, authStyleParams}, false),
+								Description:  "Send the client credentials as basic auth (header) or form parameters (params).",
+							},
+						}),
+					},
+				},
+				"token_exchange": {
+					Type:     schema.TypeList,
+					Optional: true,
+					MaxItems: 1,
+					Elem: &schema.Resource{
+						Schema: withTokenEndpointSchema(map[string]*schema.Schema{
+							"token_url": {
+								Type:     schema.TypeString,
+								Required: true,
+							},
+							"subject_token": {
+								Type:      schema.TypeString,
+								Required:  true,
+								Sensitive: true,
+							},
+							"subject_token_type": {
+								Type:     schema.TypeString,
+								Optional: true,
+								Default:  tokenTypeAccessToken,
+							},
+							"actor_token": {
+								Type:      schema.TypeString,
+								Optional:  true,
+								Sensitive: true,
+							},
+							"actor_token_type": {
+								Type:     schema.TypeString,
+								Optional: true,
+							},
+							"requested_token_type": {
+								Type:     schema.TypeString,
+								Optional: true,
+							},
+							"audience": {
+								Type:     schema.TypeString,
+								Optional: true,
+							},
+							"resource": {
+								Type:     schema.TypeString,
+								Optional: true,
+							},
+							"scopes": {
+								Type:     schema.TypeList,
+								Optional: true,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+							"client_id": {
+								Type:     schema.TypeString,
+								Optional: true,
+							},
+							"client_secret": {
+								Type:      schema.TypeString,
+								Optional:  true,
+								Sensitive: true,
+							},
+						}),
+					},
+				},
+				"jwt":        jwtSchema(),
+				"exec":       execSchema(),
+				"spiffe_jwt": spiffeJWTSchema(),
+			},
+		},
+	}
+}
+
+// credentialSource produces the metadata that authenticates a call to url
+type credentialSource interface {
+	metadata(ctx context.Context, url string) (map[string]string, error)
+}
+
+// credentialsError is a failure to get the metadata for a call
+type credentialsError struct {
+	err error
+}
+
+func (e *credentialsError) Error() string {
+	return "Error getting credentials: " + e.err.Error()
+}
+
+func (e *credentialsError) Unwrap() error {
+	return e.err
+}
+
+// parseCredentials reads a credentials block; it returns nil when the block is not set
+func parseCredentials(raw []interface{}, tokens *tokenCache) (credentialSource, error) {
+	if len(raw) == 0 || raw[0] == nil {
+		return nil, nil
+	}
+	c := raw[0].(map[string]interface{})
+
+	var sources []credentialSource
+	if cc := c["client_credentials"].([]interface{}); len(cc) > 0 && cc[0] != nil {
+		source, err := parseClientCredentials(cc[0].(map[string]interface{}), tokens)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	if te := c["token_exchange"].([]interface{}); len(te) > 0 && te[0] != nil {
+		source, err := parseTokenExchange(te[0].(map[string]interface{}), tokens)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	if j := c["jwt"].([]interface{}); len(j) > 0 && j[0] != nil {
+		source, err := parseJWT(j[0].(map[string]interface{}), tokens)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	if e := c["exec"].([]interface{}); len(e) > 0 && e[0] != nil {
+		sources = append(sources, parseExec(e[0].(map[string]interface{}), tokens))
+	}
+	if j := c["spiffe_jwt"].([]interface{}); len(j) > 0 {
+		// every argument is optional, an empty block is a nil element
+		m, _ := j[0].(map[string]interface{})
+		sources = append(sources, parseSPIFFEJWT(m, tokens))
+	}
+
+	if len(sources) != 1 {
+		return nil, fmt.Errorf("credentials must set exactly one of client_credentials, token_exchange, jwt, exec or spiffe_jwt, got %d", len(sources))
+	}
+	return sources[0], nil
+}
+
+// oauthTokenSource fetches access tokens from an OAuth2 token endpoint
+type oauthTokenSource struct {
+	tokenURL     string
+	form         url.Values
+	clientID     string
+	clientSecret string
+	authStyle    string
+	client       *http.Client
+	tokens       *tokenCache
+}
+
+// newTokenClient is the client for token_url, with the ca and timeout_ms of the block
+func newTokenClient(c map[string]interface{}) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if ca := c["ca"].(string); ca != "" {
+		roots, err := loadRoots(ca, nil, false)
+		if err != nil {
+			return nil, fmt.Errorf("token_url %v", err)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(c["timeout_ms"].(int)) * time.Millisecond,
+	}, nil
+}
+
+func parseClientCredentials(c map[string]interface{}, tokens *tokenCache) (*oauthTokenSource, error) {
+	form := url.Values{"grant_type": {grantTypeClientCredentials}}
+	if scopes := stringList(c["scopes"]); len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+	if v := c["audience"].(string); v != "" {
+		form.Set("audience", v)
+	}
+	for k, v := range c["endpoint_params"].(map[string]interface{}) {
+		form.Set(k, v.(string))
+	}
+	client, err := newTokenClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return &oauthTokenSource{
+		tokenURL:     c["token_url"].(string),
+		form:         form,
+		clientID:     c["client_id"].(string),
+		clientSecret: c["client_secret"].(string),
+		authStyle:    c["auth_style"].(string),
+		client:       client,
+		tokens:       tokens,
+	}, nil
+}
+
+func parseTokenExchange(c map[string]interface{}, tokens *tokenCache) (*oauthTokenSource, error) {
+	form := url.Values{
+		"grant_type":         {grantTypeTokenExchange},
+		"subject_token":      {c["subject_token"].(string)},
+		"subject_token_type": {c["subject_token_type"].(string)},
+	}
+	for _, k := range []string{"actor_token", "actor_token_type", "requested_token_type", "audience", "resource"} {
+		if v := c[k].(string); v != "" {
+			form.Set(k, v)
+		}
+	}
+	if scopes := stringList(c["scopes"]); len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+	client, err := newTokenClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return &oauthTokenSource{
+		tokenURL:     c["token_url"].(string),
+		form:         form,
+		clientID:     c["client_id"].(string),
+		clientSecret: c["client_secret"].(string),
+		authStyle:    authStyleHeader,
+		client:       client,
+		tokens:       tokens,
+	}, nil
+}
+
+func (s *oauthTokenSource) metadata(ctx context.Context, _ string) (map[string]string, error) {
+	token, err := s.tokens.get(s.cacheKey(), func() (*cachedToken, error) {
+		return s.fetch(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": token.value}, nil
+}
+
+// cacheKey identifies the token by everything sent to the token endpoint
+func (s *oauthTokenSource) cacheKey() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q\n%q\n%q\n%q\n", s.tokenURL, s.form.Encode(), s.clientID, s.clientSecret)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// tokenResponse is a successful RFC 6749 or RFC 8693 token response
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	IssuedTokenType  string `json:"issued_token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (s *oauthTokenSource) fetch(ctx context.Context) (*cachedToken, error) {
+	form := url.Values{}
+	for k, v := range s.form {
+		form[k] = v
+	}
+	if s.clientID != "" && s.authStyle == authStyleParams {
+		form.Set("client_id", s.clientID)
+		form.Set("client_secret", s.clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("token request to %s: %v", s.tokenURL, err)
+	}
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	req.Header.Set("accept", "application/json")
+	if s.clientID != "" && s.authStyle == authStyleHeader {
+		req.SetBasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(s.clientSecret))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request to %s: %v", s.tokenURL, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("token response from %s: %v", s.tokenURL, err)
+	}
+
+	var tr tokenResponse
+	jsonErr := json.Unmarshal(body, &tr)
+	if resp.StatusCode != http.StatusOK {
+		if jsonErr == nil && tr.Error != "" {
+			return nil, fmt.Errorf("token endpoint %s returned %s: %s %s", s.tokenURL, resp.Status, tr.Error, tr.ErrorDescription)
+		}
+		return nil, fmt.Errorf("token endpoint %s returned %s", s.tokenURL, resp.Status)
+	}
+	if jsonErr != nil {
+		return nil, fmt.Errorf("token response from %s is not json: %v", s.tokenURL, jsonErr)
+	}
+	if tr.AccessToken == "" {
+		return nil, fmt.Errorf("token response from %s has no access_token", s.tokenURL)
+	}
+
+	tokenType := tr.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") || strings.EqualFold(tokenType, "N_A") {
+		// RFC 8693 uses N_A for tokens that are not access tokens, they are still sent as bearer tokens
+		tokenType = "Bearer"
+	}
+	return newCachedToken(tokenType+" "+tr.AccessToken, time.Duration(tr.ExpiresIn)*time.Second), nil
+}
+
+// cachedToken is a credential kept in provider memory until it is about to expire
+type cachedToken struct {
+	value string
+	// metadata is set instead of value by sources that return more than a token
+	metadata  map[string]string
+	refreshAt time.Time
+}
+
+// newCachedToken returns a token valid for lifetime, or defaultTokenLifetime if lifetime is 0
+func newCachedToken(value string, lifetime time.Duration) *cachedToken {
+	if lifetime <= 0 {
+		lifetime = defaultTokenLifetime
+	}
+	window := tokenRefreshWindow
+	if lifetime/2 < window {
+		window = lifetime / 2
+	}
+	return &cachedToken{value: value, refreshAt: time.Now().Add(lifetime - window)}
+}
+
+func (t *cachedToken) valid() bool {
+	return time.Now().Before(t.refreshAt)
+}
+
+// tokenCache keeps credentials for the lifetime of the provider so parallel
+// reads share one token and it is only fetched again shortly before it expires
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]*cachedToken
+	locks  map[string]*sync.Mutex
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{
+		tokens: map[string]*cachedToken{},
+		locks:  map[string]*sync.Mutex{},
+	}
+}
+
+// get returns the cached token for key or calls fetch; concurrent callers for
+// the same key wait for a single fetch
+func (c *tokenCache) get(key string, fetch func() (*cachedToken, error)) (*cachedToken, error) {
+	c.mu.Lock()
+	lock, ok := c.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.locks[key] = lock
+	}
+	c.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	c.mu.Lock()
+	token, ok := c.tokens[key]
+	c.mu.Unlock()
+	if ok && token.valid() {
+		return token, nil
+	}
+
+	token, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.tokens[key] = token
+	c.mu.Unlock()
+	return token, nil
+}
+
+// stringList converts a schema list of strings
+func stringList(v interface{}) []string {
+	l, _ := v.([]interface{})
+	out := make([]string, 0, len(l))
+	for _, e := range l {
+		if s, ok := e.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// mergeMetadata adds the credential metadata to a copy of headers
+func mergeMetadata(headers map[string]string, md map[string]string) map[string]string {
+	merged := make(map[string]string, len(headers)+len(md))
+	for k, v := range headers {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[strings.ToLower(k)] = v
+	}
+	return merged
+}
@@ -0,0 +1,200 @@
+package provider
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenCache(t *testing.T) {
+	cache := newTokenCache()
+
+	var fetches int32
+	fetch := func(lifetime time.Duration) func() (*cachedToken, error) {
+		return func() (*cachedToken, error) {
+			atomic.AddInt32(&fetches, 1)
+			return newCachedToken("Bearer t", lifetime), nil
+		}
+	}
+
+	// parallel reads share one fetch
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.get("long", fetch(time.Hour)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if fetches != 1 {
+		t.Errorf("got %d fetches for a cached token, want 1", fetches)
+	}
+
+	// a token inside its refresh window is fetched again
+	atomic.StoreInt32(&fetches, 0)
+	cache.tokens["expiring"] = &cachedToken{value: "Bearer old", refreshAt: time.Now().Add(-time.Second)}
+	token, err := cache.get("expiring", fetch(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.value != "Bearer t" || fetches != 1 {
+		t.Errorf("expiring token was not refreshed: %q after %d fetches", token.value, fetches)
+	}
+
+	// failures are not cached
+	if _, err := cache.get("failing", func() (*cachedToken, error) { return nil, errors.New("boom") }); err == nil {
+		t.Error("expected an error")
+	}
+	if _, ok := cache.tokens["failing"]; ok {
+		t.Error("a failed fetch was cached")
+	}
+}
+
+func TestOAuthTokenClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") == grantTypeTokenExchange {
+			// a token endpoint that never answers
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"access_token":"private","token_type":"Bearer"}`)
+	}))
+	defer server.Close()
+	ca := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	source := func(grant map[string]interface{}) (credentialSource, error) {
+		block := map[string]interface{}{
+			"client_credentials": []interface{}{},
+			"token_exchange":     []interface{}{},
+			"jwt":                []interface{}{},
+			"exec":               []interface{}{},
+			"spiffe_jwt":         []interface{}{},
+		}
+		if _, ok := grant["subject_token"]; ok {
+			block["token_exchange"] = []interface{}{grant}
+		} else {
+			block["client_credentials"] = []interface{}{grant}
+		}
+		return parseCredentials([]interface{}{block}, newTokenCache())
+	}
+	clientCredentials := func(ca string) map[string]interface{} {
+		return map[string]interface{}{
+			"token_url": server.URL, "client_id": "terraform", "client_secret": "s3cr3t", "scopes": []interface{}{},
+			"audience": "", "endpoint_params": map[string]interface{}{}, "auth_style": authStyleHeader,
+			"ca": ca, "timeout_ms": 30000,
+		}
+	}
+
+	creds, err := source(clientCredentials(ca))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md, err := creds.metadata(context.Background(), ""); err != nil || md["authorization"] != "Bearer private" {
+		t.Errorf("metadata with the token endpoint ca = %v, %v", md, err)
+	}
+	creds, err = source(clientCredentials(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := creds.metadata(context.Background(), ""); err == nil || !strings.Contains(err.Error(), "unknown authority") {
+		t.Errorf("got error %v without the token endpoint ca", err)
+	}
+	if _, err := source(clientCredentials("not a certificate")); err == nil || !strings.Contains(err.Error(), "token_url ca") {
+		t.Errorf("got error %v for a ca without a certificate", err)
+	}
+
+	creds, err = source(map[string]interface{}{
+		"token_url": server.URL, "subject_token": "workload", "subject_token_type": tokenTypeAccessToken,
+		"actor_token": "", "actor_token_type": "", "requested_token_type": "", "audience": "", "resource": "",
+		"scopes": []interface{}{}, "client_id": "", "client_secret": "", "ca": ca, "timeout_ms": 200,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := creds.metadata(context.Background(), ""); err == nil || !strings.Contains(err.Error(), "Timeout") {
+		t.Errorf("got error %v from a token endpoint that never answers", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("token request gave up after %s, want timeout_ms", elapsed)
+	}
+}
+
+func TestNewCachedToken(t *testing.T) {
+	// a token without expiry is fetched again after defaultTokenLifetime
+	unknown := newCachedToken("Bearer t", 0)
+	if d := time.Until(unknown.refreshAt); d > defaultTokenLifetime || d < defaultTokenLifetime-2*tokenRefreshWindow {
+		t.Errorf("token without expiry refreshes in %s, want about %s", d, defaultTokenLifetime)
+	}
+	// short lived tokens are refreshed halfway through their lifetime
+	short := newCachedToken("Bearer t", 10*time.Second)
+	if d := time.Until(short.refreshAt); d > 5*time.Second || d < 4*time.Second {
+		t.Errorf("10s token refreshes in %s, want 5s", d)
+	}
+	long := newCachedToken("Bearer t", time.Hour)
+	if d := time.Until(long.refreshAt); d > 59*time.Minute {
+		t.Errorf("1h token refreshes in %s, want a minute before expiry", d)
+	}
+}
+
+func TestOAuthTokenSource(t *testing.T) {
+	var requests int32
+	server := newTestTokenServer(t, &requests)
+	defer server.Close()
+
+	tokens := newTokenCache()
+	creds, err := parseCredentials([]interface{}{map[string]interface{}{
+		"client_credentials": []interface{}{map[string]interface{}{
+			"token_url":       server.URL,
+			"client_id":       "terraform",
+			"client_secret":   "s3cr3t",
+			"scopes":          []interface{}{"a", "b"},
+			"audience":        "",
+			"endpoint_params": map[string]interface{}{},
+			"auth_style":      authStyleHeader,
+			"ca":              "",
+			"timeout_ms":      30000,
+		}},
+		"token_exchange": []interface{}{},
+		"jwt":            []interface{}{},
+		"exec":           []interface{}{},
+		"spiffe_jwt":     []interface{}{},
+	}}, tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		md, err := creds.metadata(context.Background(), "https://localhost/echo.EchoServer/SayHello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md["authorization"] != "Bearer cc-a b" {
+			t.Errorf("authorization = %q", md["authorization"])
+		}
+	}
+	if requests != 1 {
+		t.Errorf("got %d token requests, want 1", requests)
+	}
+
+	if _, err := parseCredentials([]interface{}{map[string]interface{}{
+		"client_credentials": []interface{}{},
+		"token_exchange":     []interface{}{},
+		"jwt":                []interface{}{},
+		"exec":               []interface{}{},
+		"spiffe_jwt":         []interface{}{},
+	}}, tokens); err == nil {
+		t.Error("expected an error for an empty credentials block")
+	}
+}
@@ -1,57 +1,110 @@
 package provider
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/psanford/lencode"
-	"golang.org/x/net/http2"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"google.golang.org/grpc"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
 	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
-	"google.golang.org/protobuf/reflect/protoregistry"
-	"google.golang.org/protobuf/types/descriptorpb"
-	"google.golang.org/protobuf/types/dynamicpb"
-	"google.golang.org/protobuf/types/known/anypb"
 )
 
 func dataSource() *schema.Resource {
 	return &schema.Resource{
 		ReadContext: dataSourceRead,
 
-		Schema: map[string]*schema.Schema{
+		Schema: withTLSSchema(map[string]*schema.Schema{
 
 			"registry_files": {
 				Type:     schema.TypeList,
 				Computed: false,
-				Required: true,
+				Optional: true,
 				Elem: &schema.Schema{
-					Type: schema.TypeString,
+					Type:             schema.TypeString,
+					ValidateDiagFunc: validateRegistryFile,
 				},
 			},
 
 			"url": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:         schema.TypeString,
+				Optional:     true,
+				ExactlyOneOf: []string{"url", "method"},
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"endpoint": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				RequiredWith: []string{"method"},
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
 				},
 			},
 
+			"method": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateMethod,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"service": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				RequiredWith:     []string{"method"},
+				ValidateDiagFunc: validateService,
+			},
+
+			"target": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ConflictsWith:    []string{"endpoint"},
+				ValidateDiagFunc: validateTarget,
+			},
+
+			"targets": {
+				Type:          schema.TypeList,
+				Optional:      true,
+				MinItems:      1,
+				ConflictsWith: []string{"endpoint", "target"},
+				Elem: &schema.Schema{
+					Type:             schema.TypeString,
+					ValidateDiagFunc: validateTarget,
+				},
+			},
+
+			"load_balancing_policy": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      policyPickFirst,
+				ValidateFunc: validation.StringInSlice(loadBalancingPolicies, false),
+			},
+
+			"authority": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
 			"sni": {
 				Type:     schema.TypeString,
-				Required: true,
+				Optional: true,
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
 				},
@@ -74,6 +127,25 @@ func dataSource() *schema.Resource {
 				},
 			},
 
+			"request_format": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      formatJSON,
+				ValidateFunc: validation.StringInSlice(requestFormats, false),
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"raw_mode": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				Elem: &schema.Schema{
+					Type: schema.TypeBool,
+				},
+			},
+
 			"payload": {
 				Type:     schema.TypeString,
 				Computed: true,
@@ -82,13 +154,82 @@ func dataSource() *schema.Resource {
 				},
 			},
 
+			"payload_textproto": {
+				Type:     schema.TypeString,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"payload_yaml": {
+				Type:     schema.TypeString,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"payload_binary_base64": {
+				Type:     schema.TypeString,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"unknown_fields": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"path": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"number": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"wire_type": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"value": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+
+			"fail_on_unknown_fields": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				Elem: &schema.Schema{
+					Type: schema.TypeBool,
+				},
+			},
+
+			"validate_response": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				Elem: &schema.Schema{
+					Type: schema.TypeBool,
+				},
+			},
+
+			"credentials": credentialsSchema(),
+			"signing":     signingSchema(),
+
 			"insecure_skip_verify": {
 				Type:     schema.TypeBool,
 				Optional: true,
 				Elem: &schema.Schema{
 					Type: schema.TypeBool,
 				},
-				Default: false,
 			},
 			"request_timeout_ms": {
 				Type:     schema.TypeInt,
@@ -98,15 +239,17 @@ func dataSource() *schema.Resource {
 				},
 			},
 			"request_type": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateMessageName,
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
 				},
 			},
 			"response_type": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateMessageName,
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
 				},
@@ -118,6 +261,11 @@ func dataSource() *schema.Resource {
 					Type: schema.TypeString,
 				},
 			},
+			"answered_target": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"connection_info": connectionSchema(),
 			"status_code": {
 				Type:     schema.TypeInt,
 				Computed: true,
@@ -133,81 +281,183 @@ func dataSource() *schema.Resource {
 					Type: schema.TypeString,
 				},
 			},
-		},
+			"pinned_spki_sha256":        pinsSchema(),
+			"resolve":                   resolveSchema(),
+			"proxy":                     proxySchema(),
+			"proxy_ca":                  proxyCASchema(),
+			"transport_engine":          transportEngineSchema(),
+			"max_receive_message_bytes": messageSizeSchema("Largest response message accepted, overriding the endpoint or provider."),
+			"max_send_message_bytes":    messageSizeSchema("Largest request message sent, overriding the endpoint or provider."),
+		}),
 	}
 }
 
 func dataSourceRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
-	url := d.Get("url").(string)
-	sni := d.Get("sni").(string)
+	config, _ := meta.(*providerConfig)
+	if config == nil {
+		config = &providerConfig{Pool: newTransportPool(defaultPoolSettings), Tokens: newTokenCache(), SPIFFESources: newSPIFFESources(), SSHClients: newSSHClients(), Balancer: newTargetBalancer()}
+	}
+
+	endpoint := config.defaultEndpoint()
+	endpoint_name := d.Get("endpoint").(string)
+	if endpoint_name != "" {
+		var endpointDiags diag.Diagnostics
+		endpoint, endpointDiags = config.findEndpoint(endpoint_name)
+		if endpointDiags.HasError() {
+			return append(diags, endpointDiags...)
+		}
+	}
+	addresses, addressDiags := resolveAddresses(d, config.BaseURL, endpoint, endpoint_name != "")
+	if addressDiags.HasError() {
+		return append(diags, addressDiags...)
+	}
+	if endpoint.SSHTunnel != nil {
+		for _, address := range addresses {
+			address.Dial.tunnel = &sshTunnel{config: endpoint.SSHTunnel, clients: config.SSHClients}
+		}
+	}
+	url := addresses[0].url()
+
+	// without sni each target is verified against its own authority
+	sni := endpoint.SNI
+	if v, ok := d.GetOk("sni"); ok {
+		sni = v.(string)
+	}
 	request_type := d.Get("request_type").(string)
 	response_type := d.Get("response_type").(string)
-	headers := d.Get("request_headers").(map[string]interface{})
+	headers := mergeHeaders(endpoint.RequestHeaders, d.Get("request_headers").(map[string]interface{}))
+
+	creds := endpoint.Credentials
+	dsCreds, err := parseCredentials(d.Get("credentials").([]interface{}), config.Tokens)
+	if err != nil {
+		return append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       "Invalid credentials",
+			Detail:        err.Error(),
+			AttributePath: cty.GetAttrPath("credentials"),
+		})
+	}
+	if dsCreds != nil {
+		creds = dsCreds
+	}
+
+	signer := endpoint.Signer
+	dsSigner, err := parseSigning(d.Get("signing").([]interface{}))
+	if err != nil {
+		return append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       "Invalid signing",
+			Detail:        err.Error(),
+			AttributePath: cty.GetAttrPath("signing"),
+		})
+	}
+	if dsSigner != nil {
+		signer = dsSigner
+	}
 
 	pbFiles := d.Get("registry_files").([]interface{})
 
-	for _, fileContentB64 := range pbFiles {
+	raw_mode := d.Get("raw_mode").(bool)
 
-		fc, ok := fileContentB64.(string)
-		if !ok {
-			return append(diags, diag.Errorf("Error converting filecontent to string")...)
+	var requestMessageType, replyMessageType protoreflect.MessageType
+	if !raw_mode {
+		if request_type == "" {
+			return append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "request_type is required unless raw_mode is set",
+				AttributePath: cty.GetAttrPath("request_type"),
+			})
 		}
-		fileContent, err := base64.StdEncoding.DecodeString(fc)
-		if err != nil {
-			return append(diags, diag.Errorf("Error decoding file .pb ")...)
+		if response_type == "" {
+			return append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "response_type is required unless raw_mode is set",
+				AttributePath: cty.GetAttrPath("response_type"),
+			})
+		}
+
+		diags = append(diags, registerFiles(cty.GetAttrPath("registry_files"), pbFiles)...)
+		if diags.HasError() {
+			return diags
+		}
+
+		var typeDiags diag.Diagnostics
+		requestMessageType, typeDiags = findMessageType("request_type", "Error finding request message type", request_type)
+		diags = append(diags, typeDiags...)
+		replyMessageType, typeDiags = findMessageType("response_type", "Error finding response message type", response_type)
+		diags = append(diags, typeDiags...)
+		if diags.HasError() {
+			return diags
 		}
-		fileDescriptors := &descriptorpb.FileDescriptorSet{}
-		err = proto.Unmarshal(fileContent, fileDescriptors)
+	}
+
+	request_body, ok := d.GetOk("request_body")
+	if !ok {
+		return append(diags, diag.Errorf("Error reading request_body")...)
+	}
+
+	request_format := d.Get("request_format").(string)
+
+	var in []byte
+	if raw_mode {
+		if request_format != formatJSON {
+			return append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       fmt.Sprintf("Error raw_mode only supports request_format json, got %s", request_format),
+				AttributePath: cty.GetAttrPath("request_format"),
+			})
+		}
+		var err error
+		in, err = encodeRawJSON(request_body.(string))
 		if err != nil {
-			return append(diags, diag.Errorf("Error unmarshaling .pb files")...)
+			return append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "Error encoding raw request_body",
+				Detail:        err.Error(),
+				AttributePath: cty.GetAttrPath("request_body"),
+			})
 		}
-		for _, pb := range fileDescriptors.GetFile() {
-			var fdr protoreflect.FileDescriptor
-			fdr, err = protodesc.NewFile(pb, protoregistry.GlobalFiles)
-			if err != nil {
-				return append(diags, diag.Errorf("Error getting proto files")...)
+	} else {
+		if request_format == formatJSON {
+			// report every offending field with its json path before protojson stops at the first one
+			for _, fieldErr := range checkJSONBody(request_body.(string), requestMessageType.Descriptor()) {
+				diags = append(diags, diag.Diagnostic{
+					Severity:      diag.Error,
+					Summary:       "Invalid request_body",
+					Detail:        fieldErr.Error(),
+					AttributePath: cty.GetAttrPath("request_body"),
+				})
 			}
-			fmt.Printf("Loading package %s\n", fdr.Package().Name())
-			dd, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(request_type))
-			if err != nil {
-				// todo catch the not found and continue
-				//	return append(diags, diag.Errorf(fmt.Sprintf("Error  FindDescriptorByName proto file %s error: [%s]", request_type, err.Error()))...)
+			if diags.HasError() {
+				return diags
 			}
-			if dd == nil {
+		}
 
-				err = protoregistry.GlobalFiles.RegisterFile(fdr)
-				if err != nil {
-					return append(diags, diag.Errorf("Error Registering proto file")...)
-				}
-				for _, m := range pb.MessageType {
-					md := fdr.Messages().ByName(protoreflect.Name(*m.Name))
-					mdType := dynamicpb.NewMessageType(md)
-
-					err = protoregistry.GlobalTypes.RegisterMessage(mdType)
-					if err != nil {
-						return append(diags, diag.Errorf("Error registering message")...)
-					}
-				}
-			}
+		requestMessage, err := decodeRequestBody(request_format, request_body.(string), requestMessageType)
+		if err != nil {
+			return append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       fmt.Sprintf("Error parsing request_body as %s", request_format),
+				Detail:        err.Error(),
+				AttributePath: cty.GetAttrPath("request_body"),
+			})
 		}
-	}
 
-	requestMessageType, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(request_type))
-	if err != nil {
-		return append(diags, diag.Errorf("Error finding request message type")...)
-	}
-	if requestMessageType == nil {
-		return append(diags, diag.Errorf("Error finding request message type")...)
+		// check the buf.validate rules before anything goes on the wire
+		diags = append(diags, validateMessage(requestMessage, "Request violates buf.validate rules", cty.GetAttrPath("request_body"))...)
+		if diags.HasError() {
+			return diags
+		}
+
+		in, err = proto.Marshal(requestMessage)
+		if err != nil {
+			return append(diags, diag.Errorf("Error marshalling request: %s", err)...)
+		}
 	}
-	//requestMessageDescriptor := requestMessageType.Descriptor()
-	// reflectRequest := requestMessageType.New()
-	// in, err := proto.Marshal(reflectRequest.Interface())
-	// if err != nil {
-	// 	return append(diags, diag.Errorf("Error generating reflectRequest")...)
-	// }
 
-	var skip_verify bool
-	skip_verify_override, ok := d.GetOk("insecure_skip_verify")
+	skip_verify := endpoint.InsecureSkipVerify
+	// GetOk would drop an explicit false that turns the endpoint or provider setting off
+	skip_verify_override, ok := d.GetOkExists("insecure_skip_verify")
 	if ok {
 		if skip_verify, ok = skip_verify_override.(bool); !ok {
 			return append(diags, diag.Errorf("Error overriding skip_verify_override")...)
@@ -218,108 +468,203 @@ func dataSourceRead(ctx context.Context, d *schema.ResourceData, meta interface{
 		InsecureSkipVerify: skip_verify,
 		ServerName:         sni,
 	}
-	castr, ok := d.GetOk("ca")
-	if ok {
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM([]byte(castr.(string)))
-		tlsConfig.RootCAs = caCertPool
+	castr := endpoint.CA
+	if v, ok := d.GetOk("ca"); ok {
+		castr = v.(string)
 	}
-
-	client := http.Client{
-		Transport: &http2.Transport{
-			TLSClientConfig: tlsConfig,
-		},
+	trust := endpoint.TLS.overlay(configGetter(d, ""))
+	pins := endpoint.PinnedSPKISHA256
+	if v, ok := d.GetOk("pinned_spki_sha256"); ok {
+		if pins, err = parsePins(v.([]interface{})); err != nil {
+			return append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "Invalid pinned_spki_sha256",
+				Detail:        err.Error(),
+				AttributePath: cty.GetAttrPath("pinned_spki_sha256"),
+			})
+		}
+	}
+	if endpoint.SPIFFE != nil {
+		// the Workload API trust bundle and SVID replace ca and the hostname check
+		tlsConfig, err = config.SPIFFESources.tlsConfig(ctx, endpoint.SPIFFE)
+		if err != nil {
+			return append(diags, diag.Errorf("Error configuring spiffe: %s", err)...)
+		}
+		tlsConfig.ServerName = sni
+		castr, skip_verify = "", false
+		trust.CAFiles, trust.UseSystemRoots = nil, false
+	}
+	if err := trust.apply(tlsConfig, castr); err != nil {
+		return append(diags, diag.Errorf("Error configuring TLS: %s", err)...)
+	}
+	if len(pins) > 0 {
+		// checked after chain verification, or instead of it with insecure_skip_verify
+		tlsConfig.VerifyConnection = chainVerifyConnection(tlsConfig.VerifyConnection, verifyPins(pins))
 	}
 
-	timeout_override, ok := d.GetOk("request_timeout_ms")
+	timeout := endpoint.RequestTimeoutMS
+	// GetOk would drop an explicit 0 that turns the endpoint or provider timeout off
+	timeout_override, ok := d.GetOkExists("request_timeout_ms")
 	if ok {
-		var timeout int
 		if timeout, ok = timeout_override.(int); !ok {
 			return append(diags, diag.Errorf("Error overriding request_timeout_ms")...)
 		}
-		client.Timeout = time.Duration(timeout) * time.Millisecond
 	}
 
-	request_body, ok := d.GetOk("request_body")
-	if !ok {
-		return append(diags, diag.Errorf("Error reading request_body")...)
-	}
+	limits := endpoint.MessageLimits.overlay(configGetter(d, ""))
 
-	a, err := anypb.New(requestMessageType.New().Interface())
-	if err != nil {
-		return append(diags, diag.Errorf("Error setting HTTP response body: %s", err)...)
+	// reads with the same target and TLS settings share connections
+	engine := endpoint.TransportEngine
+	if v := d.Get("transport_engine").(string); v != "" {
+		engine = v
+	}
+	clients := make(map[*callAddress]*http.Client, len(addresses))
+	conns := make(map[*callAddress]*grpc.ClientConn, len(addresses))
+	for _, address := range addresses {
+		cfg := tlsConfig.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName = address.serverName()
+		}
+		key := transportKey{
+			Addr:               address.Dial.key(),
+			SNI:                cfg.ServerName,
+			CA:                 castr,
+			InsecureSkipVerify: skip_verify,
+			SPIFFE:             endpoint.SPIFFE.key(),
+			Pins:               strings.Join(pins, ","),
+			TLS:                trust.key(),
+		}
+		if engine == engineGRPCGo {
+			cc, err := config.Pool.clientConn(key, address.Authority, address.Dial, cfg)
+			if err != nil {
+				return append(diags, diag.Errorf("Error creating grpc-go client for %s: %s", address.Target, err)...)
+			}
+			conns[address] = cc
+			continue
+		}
+		client := &http.Client{
+			Transport: config.Pool.transport(key, address.Dial, cfg),
+		}
+		if timeout > 0 {
+			client.Timeout = time.Duration(timeout) * time.Millisecond
+		}
+		clients[address] = client
 	}
 
-	rbody := bytes.NewReader([]byte(request_body.(string)))
+	// a retry goes through the targets again in the same order
+	order := config.Balancer.order(d.Get("load_balancing_policy").(string), addresses)
+	answered := 0
+	resp, err := callWithRetry(ctx, endpoint.Retry, func() (*grpcResponse, error) {
+		resp, i, err := callWithFailover(ctx, endpoint.Retry, addresses, order, func(address *callAddress) (*grpcResponse, error) {
+			url := address.url()
+			release, err := endpoint.Limiter.acquire(ctx, url)
+			if err != nil {
+				return nil, err
+			}
+			defer release()
 
-	buf := &bytes.Buffer{}
-	_, err = buf.ReadFrom(rbody)
-	if err != nil {
-		return append(diags, diag.Errorf("Error reading request buffer: %s", err)...)
-	}
-	err = protojson.Unmarshal(buf.Bytes(), a)
-	if err != nil {
-		return append(diags, diag.Errorf("Error setting HTTP response body: %s", err)...)
+			callHeaders := headers
+			if creds != nil {
+				md, err := creds.metadata(ctx, url)
+				if err != nil {
+					return nil, &credentialsError{err}
+				}
+				callHeaders = mergeMetadata(headers, md)
+			}
+			if engine == engineGRPCGo {
+				return doGRPCCall(ctx, conns[address], streamDesc(address.Path), address.Authority, address.Path, time.Duration(timeout)*time.Millisecond, callHeaders, in, signer, limits)
+			}
+			return doCall(ctx, clients[address], url, address.Authority, callHeaders, in, signer, limits)
+		})
+		answered = i
+		return resp, err
+	})
+	var statusErr *grpcStatusError
+	if errors.As(err, &statusErr) {
+		return append(diags, diag.Errorf("Error grpcCall returned %s", err)...)
 	}
-
-	var out bytes.Buffer
-	enc := lencode.NewEncoder(&out, lencode.SeparatorOpt([]byte{0}))
-	err = enc.Encode(a.Value)
-	if err != nil {
-		return append(diags, diag.Errorf("Error lencoding request: %s", err)...)
+	var credsErr *credentialsError
+	if errors.As(err, &credsErr) {
+		// keep the summary short, exec credentials put the command stderr in the error
+		return append(diags, diag.Diagnostic{
+			Severity: diag.Error,
+			Summary:  "Error getting credentials",
+			Detail:   credsErr.err.Error(),
+		})
 	}
-
-	reader := bytes.NewReader(out.Bytes())
-
-	req, err := http.NewRequest(http.MethodPost, url, reader)
 	if err != nil {
-		return append(diags, diag.Errorf("Error creating http client: %s", err)...)
+		return append(diags, diag.Errorf("%s", err)...)
 	}
-	req.Header.Set("content-type", "application/grpc")
+	respMessageBytes := resp.Message
 
-	for name, value := range headers {
-		v, ok := value.(string)
-		if !ok {
-			return append(diags, diag.Errorf("Error converting header [%s] to string: %s", name, err)...)
+	var jsonPayload, textPayload []byte
+	var yamlPayload string
+	var unknownFields []unknownField
+	if raw_mode {
+		rm, err := decodeRawMessage(respMessageBytes)
+		if err != nil {
+			return append(diags, diag.Errorf("Error decoding raw response: %s", err)...)
 		}
-		req.Header.Set(name, v)
-	}
+		jsonPayload, err = json.Marshal(rm)
+		if err != nil {
+			return append(diags, diag.Errorf("Error marshalling raw response: %s", err)...)
+		}
+		textPayload = []byte(rm.text())
+		yamlPayload, err = jsonToYAML(jsonPayload)
+		if err != nil {
+			return append(diags, diag.Errorf("Error marshalling yaml response: %s", err)...)
+		}
+	} else {
+		pmr := replyMessageType.New()
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return append(diags, diag.Errorf("Error creating grpcCall: %s", err)...)
-	}
-	if resp.StatusCode != http.StatusOK {
-		return append(diags, diag.Errorf("Error grpcCall status !=StatusOK  got: %s", resp.Status)...)
-	}
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return append(diags, diag.Errorf("Error setting HTTP response body: %s", err)...)
-	}
+		err := proto.Unmarshal(respMessageBytes, pmr.Interface())
+		if err != nil {
+			return append(diags, diag.Errorf("Error setting decoding lencode body: %s", err)...)
+		}
 
-	bytesReader := bytes.NewReader(bodyBytes)
-	// now unpack the wiremessage to get to the unary response
-	respMessage := lencode.NewDecoder(bytesReader, lencode.SeparatorOpt([]byte{0}))
-	respMessageBytes, err := respMessage.Decode()
-	if err != nil {
-		return append(diags, diag.Errorf("Error reading respMessageBytes: %s", err)...)
-	}
+		if d.Get("validate_response").(bool) {
+			diags = append(diags, validateMessage(pmr.Interface(), "Response violates buf.validate rules", cty.GetAttrPath("validate_response"))...)
+			if diags.HasError() {
+				return diags
+			}
+		}
 
-	replyMessageType, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(response_type))
-	if err != nil {
-		return append(diags, diag.Errorf("Error getting replyMessageType: %s", err)...)
-	}
+		// fields the descriptor does not know are kept by dynamicpb but protojson drops them
+		unknownFields, err = collectUnknownFields(pmr)
+		if err != nil {
+			return append(diags, diag.Errorf("Error reading unknown fields: %s", err)...)
+		}
+		if len(unknownFields) > 0 && d.Get("fail_on_unknown_fields").(bool) {
+			found := make([]string, 0, len(unknownFields))
+			for _, u := range unknownFields {
+				field := fmt.Sprintf("%d (%s)", u.Number, u.WireType)
+				if u.Path != "" {
+					field = u.Path + "." + field
+				}
+				found = append(found, field)
+			}
+			return append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       fmt.Sprintf("Response contains fields unknown to %s", response_type),
+				Detail:        fmt.Sprintf("The server sent fields that are not in the registered descriptor: %s. The registry_files may be older than the server.", strings.Join(found, ", ")),
+				AttributePath: cty.GetAttrPath("fail_on_unknown_fields"),
+			})
+		}
 
-	pmr := replyMessageType.New()
+		jsonPayload, err = protojson.Marshal(pmr.Interface())
+		if err != nil {
+			return append(diags, diag.Errorf("Error unmarshalling protojson response: %s", err)...)
+		}
 
-	err = proto.Unmarshal(respMessageBytes, pmr.Interface())
-	if err != nil {
-		return append(diags, diag.Errorf("Error setting decoding lencode body: %s", err)...)
-	}
+		textPayload, err = prototext.MarshalOptions{Multiline: true}.Marshal(pmr.Interface())
+		if err != nil {
+			return append(diags, diag.Errorf("Error marshalling textproto response: %s", err)...)
+		}
 
-	s, err := protojson.Marshal(pmr.Interface())
-	if err != nil {
-		return append(diags, diag.Errorf("Error unmarshalling protojson response: %s", err)...)
+		yamlPayload, err = jsonToYAML(jsonPayload)
+		if err != nil {
+			return append(diags, diag.Errorf("Error marshalling yaml response: %s", err)...)
+		}
 	}
 
 	if err = d.Set("status_code", resp.StatusCode); err != nil {
@@ -336,10 +681,44 @@ func dataSourceRead(ctx context.Context, d *schema.ResourceData, meta interface{
 		return append(diags, diag.Errorf("Error setting HTTP response headers: %s", err)...)
 	}
 
-	if err = d.Set("payload", string(s)); err != nil {
+	if err = d.Set("answered_target", addresses[answered].Target); err != nil {
+		return append(diags, diag.Errorf("Error setting answered_target: %s", err)...)
+	}
+
+	if err = d.Set("connection_info", resp.Conn.flatten()); err != nil {
+		return append(diags, diag.Errorf("Error setting connection_info: %s", err)...)
+	}
+
+	if err = d.Set("payload", string(jsonPayload)); err != nil {
 		return append(diags, diag.Errorf("Error setting HTTP response body: %s", err)...)
 	}
 
+	unknown := make([]map[string]interface{}, 0, len(unknownFields))
+	for _, u := range unknownFields {
+		unknown = append(unknown, map[string]interface{}{
+			"path":      u.Path,
+			"number":    int(u.Number),
+			"wire_type": u.WireType,
+			"value":     u.Value,
+		})
+	}
+	if err = d.Set("unknown_fields", unknown); err != nil {
+		return append(diags, diag.Errorf("Error setting unknown_fields: %s", err)...)
+	}
+
+	if err = d.Set("payload_textproto", string(textPayload)); err != nil {
+		return append(diags, diag.Errorf("Error setting payload_textproto: %s", err)...)
+	}
+
+	if err = d.Set("payload_yaml", yamlPayload); err != nil {
+		return append(diags, diag.Errorf("Error setting payload_yaml: %s", err)...)
+	}
+
+	// the bytes exactly as received so they can be checksummed or handed to other tools
+	if err = d.Set("payload_binary_base64", base64.StdEncoding.EncodeToString(respMessageBytes)); err != nil {
+		return append(diags, diag.Errorf("Error setting payload_binary_base64: %s", err)...)
+	}
+
 	// set ID as something more stable than time
 	d.SetId(url)
 
@@ -1,22 +1,40 @@
 package provider
 
 import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	echo "github.com/salrashid123/grpc_wireformat/grpc_services/src/echo"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 const (
@@ -126,6 +144,8 @@ x1mpmqYktTV/Y7QcHQsrVaZ+4WWYO0+Erp1mYrm7EUOhvGOGrp/6mw==
 
 type Server struct {
 	echo.UnimplementedEchoServerServer
+
+	unavailableCalls int32
 }
 
 // NewServer returns a new Server.
@@ -134,8 +154,23 @@ func NewServer() *Server {
 }
 
 type TestGrpcMock struct {
-	server  *grpc.Server
-	Address string
+	server   *grpc.Server
+	Address  string
+	listener *countingListener
+}
+
+// countingListener counts the connections accepted by the mock server
+type countingListener struct {
+	net.Listener
+	accepted int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt32(&l.accepted, 1)
+	}
+	return c, err
 }
 
 const testDataSourceConfig_basic = `
@@ -248,69 +283,1795 @@ func TestDataSource_test_error(t *testing.T) {
 	})
 }
 
-func (s *Server) SayHello(ctx context.Context, in *echo.EchoRequest) (*echo.EchoReply, error) {
-	mname := ""
-	m := in.MiddleName
-	if m != nil {
-		mname = m.Name
+const testDataSourceConfig_textproto = `
+data "grpc" "example" {
+
+  url                = "https://%s/echo.EchoServer/SayHello"
+  ca                 = "%s"
+  sni                = "localhost"
+
+  registry_files = [
+    "%s",
+  ]
+
+  request_type   = "echo.EchoRequest"
+  response_type  = "echo.EchoReply"
+  request_format = "textproto"
+  request_body   = <<EOT
+first_name: "sal"
+last_name: "mander"
+middle_name {
+  name: "a"
+}
+EOT
+
+}
+
+output "data" {
+  value = jsondecode(data.grpc.example.payload).message
+}
+`
+
+func TestDataSource_test_textproto(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
 	}
-	return &echo.EchoReply{Message: "Hello " + in.FirstName + " " + mname + " " + in.LastName}, nil
+	defer testHttpMock.server.GracefulStop()
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_textproto, testHttpMock.Address, caCert, echopb),
+				Check:  resource.TestCheckOutput("data", "Hello sal a mander"),
+			},
+		},
+	})
 }
 
-func setUpMockGRPCServer(tlsCert []byte, tlsKey []byte) (*TestGrpcMock, error) {
+func TestDataSource_test_payloadFormats(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
 
-	formatCaCert := strings.Replace(caCert, `\n`, "\n", -1)
-	clientCaCertPool := x509.NewCertPool()
-	ok := clientCaCertPool.AppendCertsFromPEM([]byte(formatCaCert))
-	if !ok {
-		return nil, errors.New("Could not load cacert")
+	replyBytes, err := proto.Marshal(&echo.EchoReply{Message: "Hello sal a mander"})
+	if err != nil {
+		t.Fatal(err)
 	}
-	privBlock, _ := pem.Decode([]byte(localhostKey))
-	key, err := x509.ParsePKCS1PrivateKey(privBlock.Bytes)
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_basic, testHttpMock.Address, caCert, echopb),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("data.grpc.example", "payload_textproto", regexp.MustCompile(`^message:\s+"Hello sal a mander"\n$`)),
+					resource.TestCheckResourceAttr("data.grpc.example", "payload_yaml", "message: Hello sal a mander\n"),
+					resource.TestCheckResourceAttr("data.grpc.example", "payload_binary_base64", base64.StdEncoding.EncodeToString(replyBytes)),
+				),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_rawMode = `
+data "grpc" "example" {
+
+  url                = "https://%s/echo.EchoServer/SayHello"
+  ca                 = "%s"
+  sni                = "localhost"
+
+  raw_mode = true
+  request_body = jsonencode({
+    "1" = "sal",
+    "2" = "mander",
+    "3" = {
+      "1" = "a"
+    }
+  })
+
+}
+
+output "data" {
+  value = jsondecode(data.grpc.example.payload)["1"]
+}
+`
+
+func TestDataSource_test_rawMode(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
 	if err != nil {
-		return nil, err
+		t.Fatal(err)
 	}
+	defer testHttpMock.server.GracefulStop()
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_rawMode, testHttpMock.Address, caCert),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckOutput("data", "Hello sal a mander"),
+					resource.TestCheckResourceAttr("data.grpc.example", "payload_textproto", "1: \"Hello sal a mander\"\n"),
+				),
+			},
+		},
+	})
+}
 
-	pubBlock, _ := pem.Decode([]byte(localhostCert))
-	cert, err := x509.ParseCertificate(pubBlock.Bytes)
+const testDataSourceConfig_unknownFields = `
+data "grpc" "example" {
+
+  url                = "https://%s/echo.EchoServer/SayHello"
+  ca                 = "%s"
+  sni                = "localhost"
+
+  registry_files = [
+    "%s",
+    "%s",
+  ]
+
+  request_type  = "echo.EchoRequest"
+  response_type = "drift.EmptyReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "sal",
+    last_name  = "mander",
+  })
+
+  fail_on_unknown_fields = %t
+}
+`
+
+func TestDataSource_test_unknownFields(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
 	if err != nil {
-		return nil, err
+		t.Fatal(err)
 	}
+	defer testHttpMock.server.GracefulStop()
 
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{
+	// a descriptor that is older than the server: the reply has no fields at all
+	driftpb, err := proto.Marshal(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:        proto.String("drift/drift.proto"),
+			Package:     proto.String("drift"),
+			Syntax:      proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("EmptyReply")}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	driftpbB64 := base64.StdEncoding.EncodeToString(driftpb)
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
 			{
-				PrivateKey:  key,
-				Certificate: [][]byte{cert.Raw},
+				Config: fmt.Sprintf(testDataSourceConfig_unknownFields, testHttpMock.Address, caCert, echopb, driftpbB64, false),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.grpc.example", "payload", "{}"),
+					resource.TestCheckResourceAttr("data.grpc.example", "unknown_fields.#", "1"),
+					resource.TestCheckResourceAttr("data.grpc.example", "unknown_fields.0.path", ""),
+					resource.TestCheckResourceAttr("data.grpc.example", "unknown_fields.0.number", "1"),
+					resource.TestCheckResourceAttr("data.grpc.example", "unknown_fields.0.wire_type", "bytes"),
+					resource.TestCheckResourceAttr("data.grpc.example", "unknown_fields.0.value", `"Hello sal  mander"`),
+				),
+			},
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_unknownFields, testHttpMock.Address, caCert, echopb, driftpbB64, true),
+				ExpectError: regexp.MustCompile(`Response contains fields unknown to drift.EmptyReply`),
 			},
 		},
+	})
+}
+
+const testDataSourceConfig_yamlError = `
+data "grpc" "example" {
+
+  url                = "https://%s/echo.EchoServer/SayHello"
+  ca                 = "%s"
+  sni                = "localhost"
+
+  registry_files = [
+    "%s",
+  ]
+
+  request_type   = "echo.EchoRequest"
+  response_type  = "echo.EchoReply"
+  request_format = "yaml"
+  request_body   = <<EOT
+first_name: sal
+middle_name:
+  nme: a
+EOT
+
+}
+`
+
+func TestDataSource_test_yamlError(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer testHttpMock.server.GracefulStop()
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_yamlError, testHttpMock.Address, caCert, echopb),
+				ExpectError: regexp.MustCompile(`line 3:3: unknown field "nme"`),
+			},
+		},
+	})
+}
 
-	tlsConfig.BuildNameToCertificate()
+const testDataSourceConfig_invalidBody = `
+data "grpc" "example" {
 
-	creds := credentials.NewTLS(tlsConfig)
+  url                = "https://%s/echo.EchoServer/SayHello"
+  ca                 = "%s"
+  sni                = "localhost"
 
-	l, err := net.Listen("tcp", "localhost:0") // IIRC 0 == "first available port"
+  registry_files = [
+    "%s",
+  ]
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    frist_name = "sal",
+    last_name  = "mander",
+  })
+
+}
+`
+
+const testDataSourceConfig_invalidRegistry = `
+data "grpc" "example" {
+
+  url                = "https://localhost:50051/echo.EchoServer/SayHello"
+  sni                = "localhost"
+
+  registry_files = [
+    "not a descriptor set",
+  ]
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body  = "{}"
+}
+`
+
+func TestDataSource_test_validation(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
 	if err != nil {
-		return nil, err
+		t.Fatal(err)
 	}
+	defer testHttpMock.server.GracefulStop()
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_invalidBody, testHttpMock.Address, caCert, echopb),
+				ExpectError: regexp.MustCompile(`\$\.frist_name: unknown field "frist_name" in message echo.EchoRequest`),
+			},
+			{
+				Config:      testDataSourceConfig_invalidRegistry,
+				ExpectError: regexp.MustCompile(`Invalid registry file`),
+			},
+		},
+	})
+}
 
-	sopts := []grpc.ServerOption{grpc.MaxConcurrentStreams(10)}
-	sopts = append(sopts, grpc.Creds(creds))
+const testDataSourceConfig_protovalidate = `
+data "grpc" "example" {
 
-	s := grpc.NewServer(sopts...)
-	srv := NewServer()
-	echo.RegisterEchoServerServer(s, srv)
+  url                = "https://%s/echo.EchoServer/SayHello"
+  ca                 = "%s"
+  sni                = "localhost"
 
-	fakeGreeterAddr := l.Addr().String()
-	go func() {
-		if err := s.Serve(l); err != nil {
-			panic(err)
-		}
-	}()
+  registry_files = [
+    "%s",
+  ]
 
-	return &TestGrpcMock{
-		server:  s,
-		Address: fakeGreeterAddr,
-	}, nil
+  request_type  = "vecho.EchoRequest"
+  response_type = "vecho.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "vecho.EchoRequest",
+    first_name = "%s",
+    last_name  = "mander",
+  })
+
+  validate_response = %t
+}
+
+output "data" {
+  value = jsondecode(data.grpc.example.payload).message
+}
+`
+
+func TestDataSource_test_protovalidate(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	vechopb, err := proto.Marshal(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{validatedEchoDescriptor(t)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vechopbB64 := base64.StdEncoding.EncodeToString(vechopb)
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_protovalidate, testHttpMock.Address, caCert, vechopbB64, "sal", false),
+				ExpectError: regexp.MustCompile(`first_name: value length must be at least 5 characters`),
+			},
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_protovalidate, testHttpMock.Address, caCert, vechopbB64, "salamander", false),
+				Check:  resource.TestCheckOutput("data", "Hello salamander  mander"),
+			},
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_protovalidate, testHttpMock.Address, caCert, vechopbB64, "salamander", true),
+				ExpectError: regexp.MustCompile(`message: value length must be at most 5 characters`),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_providerDefaults = `
+provider "grpc" {
+  base_url           = "https://%s"
+  ca                 = "%s"
+  sni                = "localhost"
+  request_timeout_ms = 5000
+
+  registry_files = [
+    "%s",
+  ]
+
+  request_headers = {
+    x-environment = "test"
+  }
+}
+
+data "grpc" "example" {
+
+  url = "/echo.EchoServer/SayHello"
+
+  request_headers = {
+    authorization = "bearer foo"
+  }
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "sal",
+    last_name  = "mander",
+  })
+}
+
+output "data" {
+  value = jsondecode(data.grpc.example.payload).message
+}
+`
+
+const testDataSourceConfig_providerEnv = `
+provider "grpc" {
+  sni = "localhost"
+}
+
+data "grpc" "example" {
+
+  url = "https://%s/echo.EchoServer/SayHello"
+
+  registry_files = [
+    "%s",
+  ]
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "sal",
+    last_name  = "mander",
+  })
+}
+
+output "data" {
+  value = jsondecode(data.grpc.example.payload).message
+}
+`
+
+func TestDataSource_test_providerDefaults(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_providerDefaults, testHttpMock.Address, caCert, echopb),
+				Check:  resource.TestCheckOutput("data", "Hello sal  mander"),
+			},
+		},
+	})
+}
+
+func TestDataSource_test_providerEnv(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	caFile := filepath.Join(t.TempDir(), "root-ca.crt")
+	if err := os.WriteFile(caFile, []byte(strings.Replace(caCert, `\n`, "\n", -1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GRPC_FULL_CA_FILE", caFile)
+	t.Setenv("GRPC_FULL_REQUEST_TIMEOUT_MS", "5000")
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_providerEnv, testHttpMock.Address, echopb),
+				Check:  resource.TestCheckOutput("data", "Hello sal  mander"),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_endpoint = `
+provider "grpc" {
+  endpoint {
+    name   = "echo"
+    target = "%s"
+    ca     = "%s"
+    sni    = "localhost"
+
+    registry_files = [
+      "%s",
+    ]
+
+    retry {
+      max_attempts       = %d
+      initial_backoff_ms = 10
+    }
+  }
+}
+
+data "grpc" "example" {
+  endpoint = "echo"
+  method   = "echo.EchoServer/SayHello"
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "%s",
+    last_name  = "mander",
+  })
+}
+
+output "data" {
+  value = jsondecode(data.grpc.example.payload).message
+}
+`
+
+func TestDataSource_test_endpoint(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_endpoint, testHttpMock.Address, caCert, echopb, 1, "sal"),
+				Check:  resource.TestCheckOutput("data", "Hello sal  mander"),
+			},
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_endpoint, testHttpMock.Address, caCert, echopb, 1, "invalid"),
+				ExpectError: regexp.MustCompile("grpc-status INVALID_ARGUMENT: invalid first_name"),
+			},
+			{
+				// the server fails the first two calls with UNAVAILABLE
+				Config: fmt.Sprintf(testDataSourceConfig_endpoint, testHttpMock.Address, caCert, echopb, 3, "unavailable"),
+				Check:  resource.TestCheckOutput("data", "Hello unavailable  mander"),
+			},
+			{
+				Config:      strings.Replace(fmt.Sprintf(testDataSourceConfig_endpoint, testHttpMock.Address, caCert, echopb, 1, "sal"), `endpoint = "echo"`, `endpoint = "billing"`, 1),
+				ExpectError: regexp.MustCompile(`Unknown endpoint "billing"`),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_limits = `
+provider "grpc" {
+  max_concurrent_calls = 1
+  rate_limit           = 20
+}
+
+data "grpc" "example" {
+  count = 4
+
+  url = "https://%s/echo.EchoServer/SayHello"
+  ca  = "%s"
+  sni = "localhost"
+
+  registry_files = [
+    "%s",
+  ]
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "sal${count.index}",
+    last_name  = "mander",
+  })
+}
+
+output "data" {
+  value = jsondecode(data.grpc.example[3].payload).message
+}
+`
+
+func TestDataSource_test_limits(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_limits, testHttpMock.Address, caCert, echopb),
+				Check:  resource.TestCheckOutput("data", "Hello sal3  mander"),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_credentials = `
+provider "grpc" {
+  credentials {
+    client_credentials {
+      token_url     = "%s/token"
+      client_id     = "terraform"
+      client_secret = "s3cr3t"
+      scopes        = ["echo.read"]
+    }
+  }
+}
+
+data "grpc" "provider_credentials" {
+  count = 3
+
+  url = "https://%s/echo.EchoServer/SayHello"
+  ca  = "%s"
+  sni = "localhost"
+
+  registry_files = [
+    "%s",
+  ]
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "whoami",
+  })
+}
+
+data "grpc" "exchanged" {
+  url = "https://%s/echo.EchoServer/SayHello"
+  ca  = "%s"
+  sni = "localhost"
+
+  credentials {
+    token_exchange {
+      token_url     = "%s/token"
+      subject_token = "workload-token"
+      audience      = "echo"
+    }
+  }
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "whoami",
+  })
+
+  depends_on = [data.grpc.provider_credentials]
+}
+
+output "provider_credentials" {
+  value = jsondecode(data.grpc.provider_credentials[2].payload).message
+}
+
+output "exchanged" {
+  value = jsondecode(data.grpc.exchanged.payload).message
+}
+`
+
+// newTestTokenServer is a stand-in OAuth2 token endpoint for client_credentials and token exchange
+func newTestTokenServer(t *testing.T, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("content-type", "application/json")
+		switch r.PostForm.Get("grant_type") {
+		case "client_credentials":
+			id, secret, ok := r.BasicAuth()
+			if !ok || id != "terraform" || secret != "s3cr3t" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error": "invalid_client", "error_description": "bad client secret"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"access_token": "cc-%s", "token_type": "bearer", "expires_in": 3600}`, r.PostForm.Get("scope"))
+		case "urn:ietf:params:oauth:grant-type:token-exchange":
+			fmt.Fprintf(w, `{"access_token": "exchanged-%s-for-%s", "issued_token_type": "urn:ietf:params:oauth:token-type:access_token", "token_type": "N_A", "expires_in": 3600}`,
+				r.PostForm.Get("subject_token"), r.PostForm.Get("audience"))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "unsupported_grant_type"}`)
+		}
+	}))
+}
+
+func TestDataSource_test_credentials(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	var tokenRequests int32
+	tokenServer := newTestTokenServer(t, &tokenRequests)
+	defer tokenServer.Close()
+
+	config := fmt.Sprintf(testDataSourceConfig_credentials, tokenServer.URL, testHttpMock.Address, caCert, echopb, testHttpMock.Address, caCert, tokenServer.URL)
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckOutput("provider_credentials", "Bearer cc-echo.read"),
+					resource.TestCheckOutput("exchanged", "Bearer exchanged-workload-token-for-echo"),
+				),
+			},
+			{
+				Config:      strings.Replace(config, `"s3cr3t"`, `"wrong"`, 1),
+				ExpectError: regexp.MustCompile(`invalid_client bad client secret`),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_jwt = `
+data "grpc" "jwt" {
+  url = "https://%s/echo.EchoServer/SayHello"
+  ca  = "%s"
+  sni = "localhost"
+
+  registry_files = [
+    "%s",
+  ]
+
+  credentials {
+    jwt {
+      private_key = <<EOT
+%sEOT
+      key_id      = "key-1"
+      issuer      = "terraform@example.com"
+    }
+  }
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "whoami",
+  })
+}
+
+output "jwt" {
+  value = jsondecode(data.grpc.jwt.payload).message
+}
+`
+
+func TestDataSource_test_jwt(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_jwt, testHttpMock.Address, caCert, echopb, pemEncode(t, key)),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchOutput("jwt", regexp.MustCompile(`^Bearer eyJ[\w-]+\.eyJ[\w-]+\.[\w-]+$`)),
+				),
+			},
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_jwt, testHttpMock.Address, caCert, echopb, "not a key\n"),
+				ExpectError: regexp.MustCompile(`jwt private_key: no PEM block found`),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_exec = `
+data "grpc" "exec" {
+  url = "https://%s/echo.EchoServer/SayHello"
+  ca  = "%s"
+  sni = "localhost"
+
+  registry_files = [
+    "%s",
+  ]
+
+  credentials {
+    exec {
+      command = "sh"
+      args    = ["-c", %q]
+      env = {
+        TOKEN = "from-cli"
+      }
+    }
+  }
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "whoami",
+  })
+}
+
+output "exec" {
+  value = jsondecode(data.grpc.exec.payload).message
+}
+`
+
+func TestDataSource_test_exec(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_exec, testHttpMock.Address, caCert, echopb,
+					`echo '{"metadata": {"authorization": "Bearer '$TOKEN'"}}'`),
+				Check: resource.TestCheckOutput("exec", "Bearer from-cli"),
+			},
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_exec, testHttpMock.Address, caCert, echopb,
+					`echo "session expired, run login" >&2; exit 1`),
+				ExpectError: regexp.MustCompile(`(?s)Error getting credentials.*session expired, run login`),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_spiffe = `
+provider "grpc" {
+  spiffe {
+    workload_api_socket = "%s"
+    server_id           = "%s"
+  }
+}
+
+data "grpc" "peer" {
+  url = "https://%s/echo.EchoServer/SayHello"
+
+  registry_files = [
+    "%s",
+  ]
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "peer",
+  })
+}
+
+data "grpc" "jwt_svid" {
+  url = "https://%s/echo.EchoServer/SayHello"
+
+  credentials {
+    spiffe_jwt {
+      workload_api_socket = "%s"
+    }
+  }
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "whoami",
+  })
+
+  depends_on = [data.grpc.peer]
+}
+
+output "peer" {
+  value = jsondecode(data.grpc.peer.payload).message
+}
+
+output "jwt_svid" {
+  value = jsondecode(data.grpc.jwt_svid.payload).message
+}
+`
+
+func TestDataSource_test_spiffe(t *testing.T) {
+	td := newTestTrustDomain(t)
+	api := startFakeWorkloadAPI(t, td, "spiffe://example.org/terraform")
+
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(td.serverTLSConfig(td.issue(t, "spiffe://example.org/echo", false)))))
+	echo.RegisterEchoServerServer(s, NewServer())
+	go s.Serve(l)
+	defer s.Stop()
+	addr := l.Addr().String()
+
+	config := func(serverID string) string {
+		return fmt.Sprintf(testDataSourceConfig_spiffe, api.socket, serverID, addr, echopb, addr, api.socket)
+	}
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: config("spiffe://example.org/echo"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckOutput("peer", "spiffe://example.org/terraform"),
+					resource.TestMatchOutput("jwt_svid", regexp.MustCompile(`^Bearer eyJ[\w-]+\.eyJ[\w-]+\.[\w-]+$`)),
+				),
+			},
+			{
+				Config:      config("spiffe://example.org/billing"),
+				ExpectError: regexp.MustCompile(`unexpected ID "spiffe://example.org/echo"`),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_signing = `
+data "grpc" "signed" {
+  url = "https://%s/echo.EchoServer/SayHello"
+  ca  = "%s"
+  sni = "localhost"
+
+  registry_files = [
+    "%s",
+  ]
+
+  request_headers = {
+    "x-tenant" = "billing"
+  }
+
+  signing {
+    hmac {
+      secret         = "%s"
+      key_id         = "key-1"
+      signed_headers = ["x-tenant"]
+    }
+  }
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "signed",
+    last_name  = "payload"
+  })
+}
+
+output "signed" {
+  value = jsondecode(data.grpc.signed.payload).message
+}
+`
+
+const testDataSourceConfig_sigV4 = `
+data "grpc" "signed" {
+  url = "https://%s/echo.EchoServer/SayHello"
+  ca  = "%s"
+  sni = "localhost"
+  %s
+
+  registry_files = [
+    "%s",
+  ]
+
+  signing {
+    aws_sigv4 {
+      region            = "us-east-1"
+      service           = "grpc"
+      access_key_id     = "AKIDTEST"
+      secret_access_key = "%s"
+    }
+  }
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "sigv4",
+  })
+}
+
+output "signed" {
+  value = jsondecode(data.grpc.signed.payload).message
+}
+`
+
+func TestDataSource_test_sigV4(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	// sigv4 always signs content-type, so this checks both engines sign the one they send
+	grpcGo := `transport_engine = "grpc-go"`
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_sigV4, testHttpMock.Address, caCert, grpcGo, echopb, "wrong"),
+				ExpectError: regexp.MustCompile(`UNAUTHENTICATED: bad sigv4 signature`),
+			},
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_sigV4, testHttpMock.Address, caCert, grpcGo, echopb, "sigv4-secret"),
+				Check:  resource.TestCheckOutput("signed", "sigv4 signed by AKIDTEST"),
+			},
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_sigV4, testHttpMock.Address, caCert, "", echopb, "sigv4-secret"),
+				Check:  resource.TestCheckOutput("signed", "sigv4 signed by AKIDTEST"),
+			},
+		},
+	})
+}
+
+func TestDataSource_test_signing(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_signing, testHttpMock.Address, caCert, echopb, "s3cr3t"),
+				Check:  resource.TestCheckOutput("signed", "signed by key-1"),
+			},
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_signing, testHttpMock.Address, caCert, echopb, "wrong"),
+				ExpectError: regexp.MustCompile(`UNAUTHENTICATED: bad signature`),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_pins = `
+data "grpc" "pinned" {
+  url = "https://%s/echo.EchoServer/SayHello"
+  %s
+  sni = "localhost"
+
+  registry_files = [
+    "%s",
+  ]
+
+  pinned_spki_sha256 = ["%s"]
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "sal",
+  })
+}
+
+output "pinned" {
+  value = jsondecode(data.grpc.pinned.payload).message
+}
+`
+
+func TestDataSource_test_pins(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	pin, _ := testLocalhostPin(t)
+	withCA := fmt.Sprintf("ca = %q", strings.Replace(caCert, `\n`, "\n", -1))
+
+	// an impostor sending its own leaf followed by the pinned localhost certificate
+	_, localhost := testLocalhostPin(t)
+	impostor := newTestTrustDomain(t).issue(t, "spiffe://example.org/impostor", false)
+	impostorServer := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{impostor.cert.Raw, localhost.Raw}, PrivateKey: impostor.key}},
+	})))
+	echo.RegisterEchoServerServer(impostorServer, NewServer())
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go impostorServer.Serve(l)
+	defer impostorServer.Stop()
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_pins, testHttpMock.Address, withCA, echopb, "not-a-pin"),
+				ExpectError: regexp.MustCompile(`Invalid pinned_spki_sha256`),
+			},
+			{
+				// pinned on top of chain verification
+				Config: fmt.Sprintf(testDataSourceConfig_pins, testHttpMock.Address, withCA, echopb, pin),
+				Check:  resource.TestCheckOutput("pinned", "Hello sal  "),
+			},
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_pins, l.Addr().String(), "insecure_skip_verify = true", echopb, pin),
+				ExpectError: regexp.MustCompile(`no server certificate matches pinned_spki_sha256`),
+			},
+			{
+				// pins only, for servers without a CA
+				Config: fmt.Sprintf(testDataSourceConfig_pins, testHttpMock.Address, "insecure_skip_verify = true", echopb, pin),
+				Check:  resource.TestCheckOutput("pinned", "Hello sal  "),
+			},
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_pins, testHttpMock.Address, "insecure_skip_verify = true", echopb, "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="),
+				ExpectError: regexp.MustCompile(`no server certificate matches pinned_spki_sha256, the server sent ` + regexp.QuoteMeta(pin)),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_trust = `
+provider "grpc" {
+  endpoint {
+    name   = "echo"
+    target = "%s"
+    sni    = "localhost"
+    %s
+  }
+}
+
+data "grpc" "trusted" {
+  endpoint = "echo"
+  method   = "echo.EchoServer/SayHello"
+
+  registry_files = [
+    "%s",
+  ]
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "sal",
+  })
+}
+
+output "trusted" {
+  value = jsondecode(data.grpc.trusted.payload).message
+}
+`
+
+func TestDataSource_test_trust(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	caFile := filepath.Join(t.TempDir(), "root-ca.crt")
+	if err := os.WriteFile(caFile, []byte(strings.Replace(caCert, `\n`, "\n", -1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_trust, testHttpMock.Address, `min_tls_version = "1.4"`, echopb),
+				ExpectError: regexp.MustCompile(`expected endpoint.0.min_tls_version to be one of`),
+			},
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_trust, testHttpMock.Address, `ca = "not a certificate"`, echopb),
+				ExpectError: regexp.MustCompile(`ca does not contain a PEM encoded certificate`),
+			},
+			{
+				// the test CA on top of the system roots
+				Config: fmt.Sprintf(testDataSourceConfig_trust, testHttpMock.Address, fmt.Sprintf(`
+    ca_files         = [%q]
+    use_system_roots = true
+    min_tls_version  = "1.3"`, caFile), echopb),
+				Check: resource.TestCheckOutput("trusted", "Hello sal  "),
+			},
+		},
+	})
+}
+
+func TestDataSource_test_connection(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	_, cert := testLocalhostPin(t)
+	sum := sha256.Sum256(cert.Raw)
+	_, port, _ := net.SplitHostPort(testHttpMock.Address)
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_trust, testHttpMock.Address, fmt.Sprintf("ca = %q", strings.Replace(caCert, `\n`, "\n", -1)), echopb),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.grpc.trusted", "connection_info.0.remote_ip", "127.0.0.1"),
+					resource.TestCheckResourceAttr("data.grpc.trusted", "connection_info.0.remote_port", port),
+					resource.TestCheckResourceAttr("data.grpc.trusted", "connection_info.0.tls_version", "TLS 1.3"),
+					resource.TestCheckResourceAttr("data.grpc.trusted", "connection_info.0.alpn_protocol", "h2"),
+					resource.TestCheckResourceAttr("data.grpc.trusted", "connection_info.0.server_name", "localhost"),
+					resource.TestCheckResourceAttrSet("data.grpc.trusted", "connection_info.0.cipher_suite"),
+					resource.TestCheckResourceAttr("data.grpc.trusted", "connection_info.0.server_certificates.#", "1"),
+					resource.TestCheckResourceAttr("data.grpc.trusted", "connection_info.0.server_certificates.0.dns_names.0", "localhost"),
+					resource.TestCheckResourceAttr("data.grpc.trusted", "connection_info.0.server_certificates.0.ip_addresses.0", "127.0.0.1"),
+					resource.TestCheckResourceAttr("data.grpc.trusted", "connection_info.0.server_certificates.0.issuer", "CN=Enterprise Root CA,OU=Enterprise,O=Google,C=US"),
+					resource.TestCheckResourceAttr("data.grpc.trusted", "connection_info.0.server_certificates.0.not_after", cert.NotAfter.UTC().Format(time.RFC3339)),
+					resource.TestCheckResourceAttr("data.grpc.trusted", "connection_info.0.server_certificates.0.sha256_fingerprint", hex.EncodeToString(sum[:])),
+					resource.TestMatchResourceAttr("data.grpc.trusted", "connection_info.0.server_certificates.0.pem", regexp.MustCompile(`^-----BEGIN CERTIFICATE-----`)),
+				),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_address = `
+data "grpc" "routed" {
+  %s
+  ca = "%s"
+
+  registry_files = [
+    "%s",
+  ]
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "authority",
+  })
+}
+
+output "authority" {
+  value = jsondecode(data.grpc.routed.payload).message
+}
+`
+
+func TestDataSource_test_address(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	_, port, _ := net.SplitHostPort(testHttpMock.Address)
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_address, `method = "echo.EchoServer/SayHello"`, caCert, echopb),
+				ExpectError: regexp.MustCompile(`method needs an endpoint or a target`),
+			},
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf("target = %q\n  service = \"echo.EchoServer\"\n  method = \"echo.EchoServer/SayHello\"", testHttpMock.Address), caCert, echopb),
+				ExpectError: regexp.MustCompile(`must be only the method name`),
+			},
+			{
+				// the url is the shorthand for target, authority and method
+				Config: fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf(`url = "https://localhost:%s/echo.EchoServer/SayHello"`, port), caCert, echopb),
+				Check:  resource.TestCheckOutput("authority", "localhost:"+port),
+			},
+			{
+				// dial the port-forward, route on the authority and take sni from it
+				Config: fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf(`
+  target    = %q
+  authority = "localhost:8443"
+  service   = "echo.EchoServer"
+  method    = "SayHello"`, testHttpMock.Address), caCert, echopb),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckOutput("authority", "localhost:8443"),
+					resource.TestCheckResourceAttr("data.grpc.routed", "connection_info.0.server_name", "localhost"),
+				),
+			},
+		},
+	})
+}
+
+func TestDataSource_test_targets(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	// the same server on a unix socket, unix socket paths are short so t.TempDir can be too long
+	dir, err := os.MkdirTemp("", "targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "echo.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go testHttpMock.server.Serve(l)
+
+	_, port, _ := net.SplitHostPort(testHttpMock.Address)
+	method := "\n  service = \"echo.EchoServer\"\n  method = \"SayHello\""
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_address, `target = "unix://echo.sock"`+method, caCert, echopb),
+				ExpectError: regexp.MustCompile(`must be unix:///absolute/path`),
+			},
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf(`target = "unix://%s"`, socket)+method, caCert, echopb),
+				Check:  resource.TestCheckOutput("authority", "localhost"),
+			},
+			{
+				// the first address is refused, the second answers
+				Config: fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf(`target = "ipv4:127.0.0.1:1,127.0.0.1:%s"`, port)+method, caCert, echopb),
+				Check:  resource.TestCheckOutput("authority", "127.0.0.1:1"),
+			},
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf(`target = "dns:///localhost:%s"`, port)+method, caCert, echopb),
+				Check:  resource.TestCheckOutput("authority", "localhost:"+port),
+			},
+			{
+				// a host that only exists in resolve
+				Config: fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf(`
+  url     = "https://backend.test:%s/echo.EchoServer/SayHello"
+  sni     = "localhost"
+  resolve = {
+    "backend.test:%s" = "127.0.0.1"
+  }`, port, port), caCert, echopb),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckOutput("authority", "backend.test:"+port),
+					resource.TestCheckResourceAttr("data.grpc.routed", "connection_info.0.remote_ip", "127.0.0.1"),
+				),
+			},
+		},
+	})
+}
+
+func TestDataSource_test_proxy(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	connect := httptest.NewServer(connectProxy(t))
+	defer connect.Close()
+	socks := socks5Proxy(t)
+	defer socks.Close()
+
+	hostport := strings.TrimPrefix(connect.URL, "http://")
+	target := fmt.Sprintf("\n  target  = %q\n  service = \"echo.EchoServer\"\n  method  = \"SayHello\"", testHttpMock.Address)
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_address, `proxy = "ftp://proxy"`+target, caCert, echopb),
+				ExpectError: regexp.MustCompile(`Invalid proxy`),
+			},
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf(`proxy = "http://user:wrong@%s"`, hostport)+target, caCert, echopb),
+				ExpectError: regexp.MustCompile(`407 Proxy Authentication Required`),
+			},
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf(`proxy = "http://user:secret@%s"`, hostport)+target, caCert, echopb),
+				Check:  resource.TestCheckOutput("authority", testHttpMock.Address),
+			},
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf(`proxy = "socks5://%s"`, socks.Addr())+target, caCert, echopb),
+				Check:  resource.TestCheckOutput("authority", testHttpMock.Address),
+			},
+		},
+	})
+}
+
+func TestDataSource_test_grpcGo(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	connect := httptest.NewServer(connectProxy(t))
+	defer connect.Close()
+
+	_, port, _ := net.SplitHostPort(testHttpMock.Address)
+	engine := "\n  transport_engine = \"grpc-go\""
+	method := engine + "\n  service = \"echo.EchoServer\"\n  method = \"SayHello\"\n  sni = \"localhost\""
+	signing := strings.Replace(testDataSourceConfig_signing, `sni = "localhost"`, `sni = "localhost"`+engine, 1)
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_address, `transport_engine = "grpc-java"`+"\n  target = \"localhost:1\""+method[len(engine):], caCert, echopb),
+				ExpectError: regexp.MustCompile(`expected transport_engine to be one of`),
+			},
+			{
+				Config:      fmt.Sprintf(signing, testHttpMock.Address, caCert, echopb, "wrong"),
+				ExpectError: regexp.MustCompile(`UNAUTHENTICATED: bad signature`),
+			},
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf(`target = %q`, testHttpMock.Address)+method, caCert, echopb),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckOutput("authority", testHttpMock.Address),
+					resource.TestCheckResourceAttr("data.grpc.routed", "connection_info.0.alpn_protocol", "h2"),
+					resource.TestCheckResourceAttr("data.grpc.routed", "connection_info.0.server_name", "localhost"),
+				),
+			},
+			{
+				// grpc-go resolves dns: targets itself
+				Config: fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf(`target = "dns:///localhost:%s"`, port)+method, caCert, echopb),
+				Check:  resource.TestCheckOutput("authority", "localhost:"+port),
+			},
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf(`target = %q`+"\n  proxy = \"http://user:wrong@%s\"", testHttpMock.Address, strings.TrimPrefix(connect.URL, "http://"))+method, caCert, echopb),
+				ExpectError: regexp.MustCompile(`407 Proxy Authentication Required`),
+			},
+			{
+				// the provider dials targets behind a proxy
+				Config: fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf(`target = %q`+"\n  proxy = \"http://user:secret@%s\"", testHttpMock.Address, strings.TrimPrefix(connect.URL, "http://"))+method, caCert, echopb),
+				Check:  resource.TestCheckOutput("authority", testHttpMock.Address),
+			},
+			{
+				Config: fmt.Sprintf(signing, testHttpMock.Address, caCert, echopb, "s3cr3t"),
+				Check:  resource.TestCheckOutput("signed", "signed by key-1"),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_messageSize = `
+provider "grpc" {
+  max_receive_message_bytes = %d
+
+  connection_pool {
+    initial_window_size      = 1048576
+    initial_conn_window_size = 4194304
+  }
+}
+`
+
+func TestDataSource_test_messageSize(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	method := fmt.Sprintf(`target = %q`, testHttpMock.Address) + "\n  service = \"echo.EchoServer\"\n  method = \"SayHello\"\n  sni = \"localhost\""
+	grpcGo := method + "\n  transport_engine = \"grpc-go\""
+	config := func(maxReceive int, args string) string {
+		return fmt.Sprintf(testDataSourceConfig_messageSize, maxReceive) + fmt.Sprintf(testDataSourceConfig_address, args, caCert, echopb)
+	}
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				// the reply carries the address, longer than 8 bytes
+				Config:      config(8, method),
+				ExpectError: regexp.MustCompile(`RESOURCE_EXHAUSTED: grpc: received message larger`),
+			},
+			{
+				Config:      config(8, grpcGo),
+				ExpectError: regexp.MustCompile(`RESOURCE_EXHAUSTED: grpc: received message larger`),
+			},
+			{
+				Config:      config(0, method+"\n  max_send_message_bytes = 4"),
+				ExpectError: regexp.MustCompile(`RESOURCE_EXHAUSTED: trying to send message larger`),
+			},
+			{
+				Config:      config(0, grpcGo+"\n  max_send_message_bytes = 4"),
+				ExpectError: regexp.MustCompile(`RESOURCE_EXHAUSTED: trying to send message larger`),
+			},
+			{
+				// the data source limit overrides the provider one
+				Config: config(8, grpcGo+"\n  max_receive_message_bytes = 1024"),
+				Check:  resource.TestCheckOutput("authority", testHttpMock.Address),
+			},
+			{
+				Config: config(8, method+"\n  max_receive_message_bytes = 1024"),
+				Check:  resource.TestCheckOutput("authority", testHttpMock.Address),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_roundRobin = `
+data "grpc" "example" {
+  count = 2
+
+  targets               = ["%s", "localhost:%s"]
+  load_balancing_policy = "round_robin"
+  service               = "echo.EchoServer"
+  method                = "SayHello"
+  ca                    = "%s"
+  sni                   = "localhost"
+
+  registry_files = [
+    "%s",
+  ]
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "sal",
+  })
+}
+
+output "answered" {
+  value = join(",", sort(data.grpc.example[*].answered_target))
+}
+`
+
+func TestDataSource_test_failover(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	// a port nothing listens on
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	_, port, _ := net.SplitHostPort(testHttpMock.Address)
+	method := "\n  service = \"echo.EchoServer\"\n  method = \"SayHello\"\n  sni = \"localhost\""
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_address, `load_balancing_policy = "random"`+"\n  target = \"localhost:1\""+method, caCert, echopb),
+				ExpectError: regexp.MustCompile(`expected load_balancing_policy to be one of`),
+			},
+			{
+				// the first target refuses the connection, the call fails over to the second
+				Config: fmt.Sprintf(testDataSourceConfig_address, fmt.Sprintf(`targets = [%q, %q]`, closed.Addr().String(), testHttpMock.Address)+method, caCert, echopb),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckOutput("authority", testHttpMock.Address),
+					resource.TestCheckResourceAttr("data.grpc.routed", "answered_target", testHttpMock.Address),
+				),
+			},
+			{
+				// two reads in one run start at different targets
+				Config: fmt.Sprintf(testDataSourceConfig_roundRobin, testHttpMock.Address, port, caCert, echopb),
+				Check:  resource.TestCheckOutput("answered", fmt.Sprintf("%s,localhost:%s", testHttpMock.Address, port)),
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_sshTunnel = `
+provider "grpc" {
+  ssh_tunnel {
+    host             = "%s"
+    user             = "deploy"
+    private_key      = file("%s")
+    known_hosts_file = "%s"
+  }
+}
+
+data "grpc" "example" {
+  count = 3
+
+  target  = "%s"
+  service = "echo.EchoServer"
+  method  = "SayHello"
+  ca      = "%s"
+  sni     = "localhost"
+
+  registry_files = [
+    "%s",
+  ]
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "sal${count.index}",
+    last_name  = "mander",
+  })
+}
+
+output "data" {
+  value = jsondecode(data.grpc.example[1].payload).message
+}
+`
+
+func TestDataSource_test_sshTunnel(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	key, signer := newTestSSHKey(t)
+	keyFile := writeTestFile(t, "id_ed25519", []byte(key))
+	server := newTestSSHServer(t, signer.PublicKey())
+	other := newTestSSHServer(t, signer.PublicKey())
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      fmt.Sprintf(testDataSourceConfig_sshTunnel, server.addr, keyFile, other.knownHosts, testHttpMock.Address, caCert, echopb),
+				ExpectError: regexp.MustCompile(`knownhosts: key is unknown`),
+			},
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_sshTunnel, server.addr, keyFile, server.knownHosts, testHttpMock.Address, caCert, echopb),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckOutput("data", "Hello sal1  mander"),
+					func(*terraform.State) error {
+						// plan and apply configure the provider once each, the reads within share a connection
+						if n := atomic.LoadInt32(&server.handshakes); n > 2 {
+							return fmt.Errorf("%d ssh handshakes for 3 reads in each of plan and apply", n)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func (s *Server) SayHello(ctx context.Context, in *echo.EchoRequest) (*echo.EchoReply, error) {
+	switch in.FirstName {
+	case "whoami":
+		// echo the credentials the call was made with
+		md, _ := metadata.FromIncomingContext(ctx)
+		return &echo.EchoReply{Message: strings.Join(md.Get("authorization"), ",")}, nil
+	case "peer":
+		// echo the SPIFFE ID of the client certificate
+		if p, ok := peer.FromContext(ctx); ok {
+			if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 && len(info.State.PeerCertificates[0].URIs) > 0 {
+				return &echo.EchoReply{Message: info.State.PeerCertificates[0].URIs[0].String()}, nil
+			}
+		}
+		return &echo.EchoReply{Message: "anonymous"}, nil
+	case "signed":
+		// check the hmac signature over the framed request as the provider sent it
+		md, _ := metadata.FromIncomingContext(ctx)
+		if len(md.Get("x-signature")) == 0 || len(md.Get("x-signature-timestamp")) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "unsigned request")
+		}
+		b, err := proto.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		framed := append([]byte{0, byte(len(b) >> 24), byte(len(b) >> 16), byte(len(b) >> 8), byte(len(b))}, b...)
+		sum := sha256.Sum256(framed)
+		mac := hmac.New(sha256.New, []byte("s3cr3t"))
+		fmt.Fprintf(mac, "POST\n/echo.EchoServer/SayHello\n%s\nx-tenant:%s\n%x", md.Get("x-signature-timestamp")[0], strings.Join(md.Get("x-tenant"), ","), sum)
+		if md.Get("x-signature")[0] != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+			return nil, status.Error(codes.Unauthenticated, "bad signature")
+		}
+		return &echo.EchoReply{Message: "signed by " + strings.Join(md.Get("x-signature-key-id"), ",")}, nil
+	case "sigv4":
+		// recompute the SigV4 signature over the headers it names, as received
+		md, _ := metadata.FromIncomingContext(ctx)
+		auth := strings.Join(md.Get("authorization"), ",")
+		i := strings.Index(auth, "SignedHeaders=")
+		if i < 0 || len(md.Get("x-amz-date")) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "unsigned request")
+		}
+		headers := map[string]string{}
+		for _, name := range strings.Split(strings.SplitN(auth[i+len("SignedHeaders="):], ",", 2)[0], ";") {
+			if name == "host" {
+				headers[name] = strings.Join(md.Get(":authority"), ",")
+				continue
+			}
+			headers[name] = strings.Join(md.Get(name), ",")
+		}
+		b, err := proto.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(append([]byte{0, byte(len(b) >> 24), byte(len(b) >> 16), byte(len(b) >> 8), byte(len(b))}, b...))
+		date, err := time.Parse(sigV4TimeFormat, md.Get("x-amz-date")[0])
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if auth != sigV4Authorization("POST", "/echo.EchoServer/SayHello", headers, hex.EncodeToString(sum[:]), date, "us-east-1", "grpc", "AKIDTEST", "sigv4-secret") {
+			return nil, status.Error(codes.Unauthenticated, "bad sigv4 signature over "+strings.Join(md.Get("content-type"), ","))
+		}
+		return &echo.EchoReply{Message: "sigv4 signed by AKIDTEST"}, nil
+	case "authority":
+		// echo the :authority the server routes on
+		md, _ := metadata.FromIncomingContext(ctx)
+		return &echo.EchoReply{Message: strings.Join(md.Get(":authority"), ",")}, nil
+	case "invalid":
+		return nil, status.Error(codes.InvalidArgument, "invalid first_name")
+	case "unavailable":
+		// fail the first two calls so retries can be tested
+		if atomic.AddInt32(&s.unavailableCalls, 1) <= 2 {
+			return nil, status.Error(codes.Unavailable, "try again")
+		}
+	}
+	mname := ""
+	m := in.MiddleName
+	if m != nil {
+		mname = m.Name
+	}
+	return &echo.EchoReply{Message: "Hello " + in.FirstName + " " + mname + " " + in.LastName}, nil
+}
+
+func setUpMockGRPCServer(tlsCert []byte, tlsKey []byte) (*TestGrpcMock, error) {
+
+	formatCaCert := strings.Replace(caCert, `\n`, "\n", -1)
+	clientCaCertPool := x509.NewCertPool()
+	ok := clientCaCertPool.AppendCertsFromPEM([]byte(formatCaCert))
+	if !ok {
+		return nil, errors.New("Could not load cacert")
+	}
+	privBlock, _ := pem.Decode([]byte(localhostKey))
+	key, err := x509.ParsePKCS1PrivateKey(privBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	pubBlock, _ := pem.Decode([]byte(localhostCert))
+	cert, err := x509.ParseCertificate(pubBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{
+			{
+				PrivateKey:  key,
+				Certificate: [][]byte{cert.Raw},
+			},
+		},
+	}
+
+	tlsConfig.BuildNameToCertificate()
+
+	creds := credentials.NewTLS(tlsConfig)
+
+	l, err := net.Listen("tcp", "localhost:0") // IIRC 0 == "first available port"
+	if err != nil {
+		return nil, err
+	}
+
+	sopts := []grpc.ServerOption{grpc.MaxConcurrentStreams(10)}
+	sopts = append(sopts, grpc.Creds(creds))
+
+	s := grpc.NewServer(sopts...)
+	srv := NewServer()
+	echo.RegisterEchoServerServer(s, srv)
+
+	fakeGreeterAddr := l.Addr().String()
+	cl := &countingListener{Listener: l}
+	go func() {
+		if err := s.Serve(cl); err != nil {
+			panic(err)
+		}
+	}()
+
+	return &TestGrpcMock{
+		server:   s,
+		Address:  fakeGreeterAddr,
+		listener: cl,
+	}, nil
+}
+
+const testDataSourceConfig_skipVerify = `
+provider "grpc" {
+  insecure_skip_verify = true
+  endpoint {
+    name   = "echo"
+    target = "%s"
+    sni    = "localhost"
+  }
+}
+
+data "grpc" "skip" {
+  endpoint = "echo"
+  method   = "echo.EchoServer/SayHello"
+  %s
+
+  registry_files = [
+    "%s",
+  ]
+
+  request_type  = "echo.EchoRequest"
+  response_type = "echo.EchoReply"
+  request_body = jsonencode({
+    "@type"    = "echo.EchoRequest",
+    first_name = "sal",
+  })
+}
+
+output "skip" {
+  value = jsondecode(data.grpc.skip.payload).message
+}
+`
+
+func TestDataSource_test_skipVerifyOverride(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				// an explicit false verifies the chain the provider would skip
+				Config:      fmt.Sprintf(testDataSourceConfig_skipVerify, testHttpMock.Address, "insecure_skip_verify = false", echopb),
+				ExpectError: regexp.MustCompile(`certificate signed by unknown authority`),
+			},
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_skipVerify, testHttpMock.Address, "", echopb),
+				Check:  resource.TestCheckOutput("skip", "Hello sal  "),
+			},
+		},
+	})
 }
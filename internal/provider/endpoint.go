@@ -0,0 +1,351 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// endpointSchema is one named endpoint block of the provider
+func endpointSchema() *schema.Resource {
+	return &schema.Resource{
+		Schema: withTLSSchema(map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "Name data sources use to refer to this endpoint.",
+			},
+			"target": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "host:port of the server, eg billing.internal:443, or a unix:, unix-abstract:, dns:, ipv4: or ipv6: target.",
+			},
+			"authority": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "HTTP/2 :authority sent to the server, default target.",
+			},
+			"ca": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"sni": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"insecure_skip_verify": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Skip server TLS verification, overriding the provider in either direction.",
+			},
+			"pinned_spki_sha256":        pinsSchema(),
+			"resolve":                   resolveSchema(),
+			"proxy":                     proxySchema(),
+			"proxy_ca":                  proxyCASchema(),
+			"transport_engine":          transportEngineSchema(),
+			"max_receive_message_bytes": messageSizeSchema("Largest response message accepted, overriding the provider."),
+			"max_send_message_bytes":    messageSizeSchema("Largest request message sent, overriding the provider."),
+			"request_timeout_ms": {
+				Type:     schema.TypeInt,
+				Optional: true,
+			},
+			"request_headers": {
+				Type:     schema.TypeMap,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"registry_files": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:             schema.TypeString,
+					ValidateDiagFunc: validateRegistryFile,
+				},
+			},
+			"max_concurrent_calls": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Calls in flight to this endpoint, replaces the provider limit; unset shares the provider limit.",
+			},
+			"rate_limit": {
+				Type:         schema.TypeFloat,
+				Optional:     true,
+				ValidateFunc: validation.FloatAtLeast(0),
+				Description:  "Calls per second to this endpoint, replaces the provider limit; unset shares the provider limit.",
+			},
+			"rate_limit_burst": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.IntAtLeast(1),
+				Description:  "Calls that may be sent at once before the endpoint rate_limit applies, default the provider burst.",
+			},
+			"credentials": credentialsSchema(),
+			"spiffe":      spiffeSchema(),
+			"signing":     signingSchema(),
+			"ssh_tunnel":  sshTunnelSchema(),
+			"retry": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"max_attempts": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Default:      3,
+							ValidateFunc: validation.IntAtLeast(0),
+						},
+						"initial_backoff_ms": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Default:      100,
+							ValidateFunc: validation.IntAtLeast(0),
+						},
+						"max_backoff_ms": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Default:      5000,
+							ValidateFunc: validation.IntAtLeast(0),
+						},
+						"retryable_status_codes": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validation.StringInSlice(grpcCodeNames[1:], false),
+							},
+							Description: "Status codes that are retried, default UNAVAILABLE.",
+						},
+					},
+				},
+			},
+		}),
+	}
+}
+
+// endpointConfig is a named endpoint of the provider with the provider defaults applied
+type endpointConfig struct {
+	Name               string
+	Target             string
+	Authority          string
+	CA                 string
+	SNI                string
+	InsecureSkipVerify bool
+	PinnedSPKISHA256   []string
+	TLS                tlsSettings
+	Resolve            map[string]string
+	Proxy              string
+	ProxyCA            string
+	TransportEngine    string
+	MessageLimits      messageLimits
+	RequestTimeoutMS   int
+	RequestHeaders     map[string]string
+	Retry              *retryConfig
+	Limiter            *callLimiter
+	Credentials        credentialSource
+	SPIFFE             *spiffeConfig
+	Signer             requestSigner
+	SSHTunnel          *sshTunnelConfig
+}
+
+// parseEndpoints reads the endpoint blocks, layering each over the provider defaults
+func parseEndpoints(d *schema.ResourceData, config *providerConfig) (map[string]*endpointConfig, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	endpoints := map[string]*endpointConfig{}
+	for i, raw := range d.Get("endpoint").([]interface{}) {
+		e := raw.(map[string]interface{})
+		path := cty.GetAttrPath("endpoint").IndexInt(i)
+		get := configGetter(d, fmt.Sprintf("endpoint.%d.", i))
+
+		ep := &endpointConfig{
+			Name:               e["name"].(string),
+			Target:             e["target"].(string),
+			Authority:          e["authority"].(string),
+			CA:                 config.CA,
+			SNI:                config.SNI,
+			InsecureSkipVerify: config.InsecureSkipVerify,
+			PinnedSPKISHA256:   config.PinnedSPKISHA256,
+			TLS:                config.TLS.overlay(get),
+			Resolve:            mergeResolve(config.Resolve, e["resolve"].(map[string]interface{})),
+			Proxy:              config.Proxy,
+			ProxyCA:            config.ProxyCA,
+			TransportEngine:    config.TransportEngine,
+			MessageLimits:      config.MessageLimits.overlay(get),
+			RequestTimeoutMS:   config.RequestTimeoutMS,
+			RequestHeaders:     mergeHeaders(config.RequestHeaders, e["request_headers"].(map[string]interface{})),
+			SPIFFE:             config.SPIFFE,
+			SSHTunnel:          config.SSHTunnel,
+		}
+		if _, ok := endpoints[ep.Name]; ok {
+			return nil, append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       fmt.Sprintf("Duplicate endpoint %q", ep.Name),
+				AttributePath: path.GetAttr("name"),
+			})
+		}
+		if _, err := parseTarget(ep.Target); err != nil {
+			return nil, append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "Invalid endpoint target",
+				Detail:        err.Error(),
+				AttributePath: path.GetAttr("target"),
+			})
+		}
+		if v, ok := get("insecure_skip_verify"); ok {
+			// an explicit false turns the provider setting off
+			ep.InsecureSkipVerify = v.(bool)
+		}
+		if v := e["ca"].(string); v != "" {
+			ep.CA = v
+		}
+		if v := e["sni"].(string); v != "" {
+			ep.SNI = v
+		}
+		if v := e["proxy"].(string); v != "" {
+			ep.Proxy = v
+		}
+		if v := e["proxy_ca"].(string); v != "" {
+			ep.ProxyCA = v
+		}
+		if v := e["transport_engine"].(string); v != "" {
+			ep.TransportEngine = v
+		}
+		if v := e["pinned_spki_sha256"].([]interface{}); len(v) > 0 {
+			pins, err := parsePins(v)
+			if err != nil {
+				return nil, append(diags, diag.Diagnostic{
+					Severity:      diag.Error,
+					Summary:       "Invalid pinned_spki_sha256",
+					Detail:        err.Error(),
+					AttributePath: path.GetAttr("pinned_spki_sha256"),
+				})
+			}
+			ep.PinnedSPKISHA256 = pins
+		}
+		if v := parseSPIFFE(e["spiffe"].([]interface{})); v != nil {
+			ep.SPIFFE = v
+		}
+		tunnel, err := parseSSHTunnel(e["ssh_tunnel"].([]interface{}))
+		if err != nil {
+			return nil, append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "Invalid ssh_tunnel",
+				Detail:        err.Error(),
+				AttributePath: path.GetAttr("ssh_tunnel"),
+			})
+		}
+		if tunnel != nil {
+			ep.SSHTunnel = tunnel
+		}
+		if v, ok := get("request_timeout_ms"); ok {
+			// 0 turns a provider timeout off
+			ep.RequestTimeoutMS = v.(int)
+		}
+		if r := e["retry"].([]interface{}); len(r) > 0 && r[0] != nil {
+			rc := r[0].(map[string]interface{})
+			ep.Retry = &retryConfig{
+				MaxAttempts:      rc["max_attempts"].(int),
+				InitialBackoffMS: rc["initial_backoff_ms"].(int),
+				MaxBackoffMS:     rc["max_backoff_ms"].(int),
+			}
+			for _, c := range rc["retryable_status_codes"].([]interface{}) {
+				ep.Retry.RetryableStatusCodes = append(ep.Retry.RetryableStatusCodes, c.(string))
+			}
+			if len(ep.Retry.RetryableStatusCodes) == 0 {
+				ep.Retry.RetryableStatusCodes = []string{"UNAVAILABLE"}
+			}
+		}
+
+		ep.Credentials = config.Credentials
+		creds, err := parseCredentials(e["credentials"].([]interface{}), config.Tokens)
+		if err != nil {
+			return nil, append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "Invalid credentials",
+				Detail:        err.Error(),
+				AttributePath: path.GetAttr("credentials"),
+			})
+		}
+		if creds != nil {
+			ep.Credentials = creds
+		}
+
+		ep.Signer = config.Signer
+		signer, err := parseSigning(e["signing"].([]interface{}))
+		if err != nil {
+			return nil, append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "Invalid signing",
+				Detail:        err.Error(),
+				AttributePath: path.GetAttr("signing"),
+			})
+		}
+		if signer != nil {
+			ep.Signer = signer
+		}
+
+		// the limits an endpoint sets are its own, 0 for none; the ones it leaves
+		// unset are shared with the provider and every endpoint that leaves them unset
+		ep.Limiter = config.Limiter.overlay(get, config.RateLimitBurst)
+
+		diags = append(diags, registerFiles(path.GetAttr("registry_files"), e["registry_files"].([]interface{}))...)
+		if diags.HasError() {
+			return nil, diags
+		}
+		endpoints[ep.Name] = ep
+	}
+	return endpoints, diags
+}
+
+// findEndpoint looks up the endpoint named by a data source
+func (c *providerConfig) findEndpoint(name string) (*endpointConfig, diag.Diagnostics) {
+	ep, ok := c.Endpoints[name]
+	if !ok {
+		names := make([]string, 0, len(c.Endpoints))
+		for n := range c.Endpoints {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		detail := "the provider has no endpoint blocks"
+		if len(names) > 0 {
+			detail = fmt.Sprintf("configured endpoints are %s", strings.Join(names, ", "))
+		}
+		return nil, diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       fmt.Sprintf("Unknown endpoint %q", name),
+			Detail:        detail,
+			AttributePath: cty.GetAttrPath("endpoint"),
+		}}
+	}
+	return ep, nil
+}
+
+// validateMethod checks method is a fully qualified service and method, eg echo.EchoServer/SayHello,
+// or only the method name for use with service
+func validateMethod(v interface{}, path cty.Path) diag.Diagnostics {
+	method, ok := v.(string)
+	if !ok || method == "" {
+		return nil
+	}
+	err := checkMethodPath("/" + strings.TrimPrefix(method, "/"))
+	if !strings.Contains(method, "/") && !strings.ContainsAny(method, " ?#%") {
+		err = nil
+	}
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid method",
+			Detail:        fmt.Sprintf("%q is not a method like \"echo.EchoServer/SayHello\", or \"SayHello\" with service", method),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestValidateMethod(t *testing.T) {
+	for _, m := range []string{"echo.EchoServer/SayHello", "/echo.EchoServer/SayHello", "SayHello"} {
+		if diags := validateMethod(m, nil); diags.HasError() {
+			t.Errorf("validateMethod(%q): %v", m, diags)
+		}
+	}
+	for _, m := range []string{"Say Hello", "echo.EchoServer/", "/a/b/c", "echo.EchoServer/SayHello?x=1"} {
+		if diags := validateMethod(m, nil); !diags.HasError() {
+			t.Errorf("validateMethod(%q): expected an error", m)
+		}
+	}
+}
+
+func TestParseEndpointsExplicitFalse(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, New().Schema, map[string]interface{}{
+		"insecure_skip_verify": true,
+		"use_system_roots":     true,
+		"endpoint": []interface{}{
+			map[string]interface{}{"name": "inherits", "target": "localhost:8081"},
+			map[string]interface{}{"name": "verifies", "target": "localhost:8081", "insecure_skip_verify": false, "use_system_roots": false},
+		},
+	})
+	raw, diags := providerConfigure(context.Background(), d)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	endpoints := raw.(*providerConfig).Endpoints
+	if ep := endpoints["inherits"]; !ep.InsecureSkipVerify || !ep.TLS.UseSystemRoots {
+		t.Errorf("endpoint without settings = %+v, want the provider settings", ep)
+	}
+	// an explicit false turns the provider settings off
+	if ep := endpoints["verifies"]; ep.InsecureSkipVerify || ep.TLS.UseSystemRoots {
+		t.Errorf("endpoint setting false = %+v", ep)
+	}
+}
+
+func TestParseEndpointsZeroOverrides(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, New().Schema, map[string]interface{}{
+		"request_timeout_ms":        5000,
+		"max_concurrent_calls":      2,
+		"rate_limit":                10.0,
+		"max_receive_message_bytes": 1 << 20,
+		"endpoint": []interface{}{
+			map[string]interface{}{"name": "inherits", "target": "localhost:8081"},
+			map[string]interface{}{"name": "unlimited", "target": "localhost:8081", "request_timeout_ms": 0, "rate_limit": 0.0, "max_receive_message_bytes": 0},
+		},
+	})
+	raw, diags := providerConfigure(context.Background(), d)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	config := raw.(*providerConfig)
+	if ep := config.Endpoints["inherits"]; ep.RequestTimeoutMS != 5000 || ep.Limiter != config.Limiter || ep.MessageLimits.MaxReceive != 1<<20 {
+		t.Errorf("endpoint without settings = %+v, want the provider settings", ep)
+	}
+	// 0 turns the provider timeout and rate limit off, the unset max_concurrent_calls stays shared
+	ep := config.Endpoints["unlimited"]
+	if ep.RequestTimeoutMS != 0 || ep.Limiter.rate != nil || ep.Limiter.slots != config.Limiter.slots || ep.MessageLimits.MaxReceive != 0 {
+		t.Errorf("endpoint setting 0 = %+v, limiter %+v", ep, ep.Limiter)
+	}
+}
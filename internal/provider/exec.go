@@ -0,0 +1,169 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// execSchema is the exec block of credentials
+func execSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"command": {
+					Type:        schema.TypeString,
+					Required:    true,
+					Description: "Command printing the metadata as json, looked up in PATH.",
+				},
+				"args": {
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+				"env": {
+					Type:     schema.TypeMap,
+					Optional: true,
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+					Description: "Added to the environment of the provider.",
+				},
+				"timeout_ms": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Default:      30000,
+					ValidateFunc: validation.IntAtLeast(1),
+				},
+			},
+		},
+	}
+}
+
+// execSource runs a command for the call metadata, like kubeconfig exec plugins
+// and aws credential_process
+type execSource struct {
+	command string
+	args    []string
+	env     map[string]string
+	timeout time.Duration
+	tokens  *tokenCache
+}
+
+func parseExec(c map[string]interface{}, tokens *tokenCache) *execSource {
+	s := &execSource{
+		command: c["command"].(string),
+		args:    stringList(c["args"]),
+		env:     map[string]string{},
+		timeout: time.Duration(c["timeout_ms"].(int)) * time.Millisecond,
+		tokens:  tokens,
+	}
+	for k, v := range c["env"].(map[string]interface{}) {
+		s.env[k] = v.(string)
+	}
+	return s
+}
+
+// execOutput is what the command prints on stdout
+type execOutput struct {
+	Metadata map[string]string `json:"metadata"`
+	// Expiry is an RFC 3339 time; without it the metadata is kept until the provider exits
+	Expiry string `json:"expiry"`
+}
+
+func (s *execSource) metadata(ctx context.Context, _ string) (map[string]string, error) {
+	token, err := s.tokens.get(s.cacheKey(), func() (*cachedToken, error) {
+		return s.run(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return token.metadata, nil
+}
+
+// cacheKey identifies the credential by the command line and environment
+func (s *execSource) cacheKey() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "exec\n%q\n%q\n", s.command, s.args)
+	keys := make([]string, 0, len(s.env))
+	for k := range s.env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "%q=%q\n", k, s.env[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (s *execSource) run(ctx context.Context) (*cachedToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.command, s.args...)
+	cmd.Env = os.Environ()
+	for k, v := range s.env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", s.timeout)
+		}
+		return nil, fmt.Errorf("exec %s: %v%s", s.command, err, stderrDetail(stderr.String()))
+	}
+
+	var out execOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("exec %s printed invalid json: %v%s", s.command, err, stderrDetail(stderr.String()))
+	}
+	if len(out.Metadata) == 0 {
+		return nil, fmt.Errorf("exec %s printed no metadata%s", s.command, stderrDetail(stderr.String()))
+	}
+
+	var lifetime time.Duration
+	if out.Expiry != "" {
+		expiry, err := time.Parse(time.RFC3339, out.Expiry)
+		if err != nil {
+			return nil, fmt.Errorf("exec %s printed an invalid expiry: %v", s.command, err)
+		}
+		if lifetime = time.Until(expiry); lifetime <= 0 {
+			return nil, fmt.Errorf("exec %s printed metadata that expired at %s", s.command, out.Expiry)
+		}
+	}
+
+	md := make(map[string]string, len(out.Metadata))
+	for k, v := range out.Metadata {
+		md[strings.ToLower(k)] = v
+	}
+	token := newCachedToken("", lifetime)
+	token.metadata = md
+	return token, nil
+}
+
+// stderrDetail appends what the command wrote to stderr to an error message
+func stderrDetail(stderr string) string {
+	if stderr = strings.TrimSpace(stderr); stderr == "" {
+		return ""
+	}
+	return "\nstderr:\n" + stderr
+}
@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testExecSource(script string, env map[string]interface{}) *execSource {
+	return parseExec(map[string]interface{}{
+		"command":    "sh",
+		"args":       []interface{}{"-c", script},
+		"env":        env,
+		"timeout_ms": 5000,
+	}, newTokenCache())
+}
+
+func TestExecSource(t *testing.T) {
+	runs := filepath.Join(t.TempDir(), "runs")
+	expiry := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	s := testExecSource(`echo run >> "$RUNS"; echo '{"metadata": {"Authorization": "Bearer from-cli", "x-team": "'"$TEAM"'"}, "expiry": "`+expiry+`"}'`,
+		map[string]interface{}{"RUNS": runs, "TEAM": "billing"})
+
+	for i := 0; i < 3; i++ {
+		md, err := s.metadata(context.Background(), "https://localhost/echo.EchoServer/SayHello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md["authorization"] != "Bearer from-cli" || md["x-team"] != "billing" {
+			t.Errorf("metadata = %v", md)
+		}
+	}
+	b, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "run"); n != 1 {
+		t.Errorf("command ran %d times, want 1", n)
+	}
+
+	token := s.tokens.tokens[s.cacheKey()]
+	if d := time.Until(token.refreshAt); d < 58*time.Minute || d > time.Hour {
+		t.Errorf("refresh in %s, want a minute before the expiry", d)
+	}
+
+	// output without an expiry is not cached for longer than defaultTokenLifetime
+	s = testExecSource(`echo '{"metadata": {"authorization": "Bearer from-cli"}}'`, nil)
+	if _, err := s.metadata(context.Background(), "https://localhost/echo.EchoServer/SayHello"); err != nil {
+		t.Fatal(err)
+	}
+	token = s.tokens.tokens[s.cacheKey()]
+	if d := time.Until(token.refreshAt); d > defaultTokenLifetime {
+		t.Errorf("refresh in %s without an expiry, want at most %s", d, defaultTokenLifetime)
+	}
+}
+
+func TestExecSourceErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"exit status", `echo "not logged in, run login" >&2; exit 3`, "exit status 3\nstderr:\nnot logged in, run login"},
+		{"invalid json", `echo nope`, "exec sh printed invalid json"},
+		{"no metadata", `echo '{}'`, "exec sh printed no metadata"},
+		{"expired", `echo '{"metadata": {"authorization": "Bearer x"}, "expiry": "2020-01-01T00:00:00Z"}'`, "expired at 2020-01-01T00:00:00Z"},
+		{"bad expiry", `echo '{"metadata": {"authorization": "Bearer x"}, "expiry": "tomorrow"}'`, "invalid expiry"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := testExecSource(tc.script, map[string]interface{}{})
+			_, err := s.metadata(context.Background(), "https://localhost/echo.EchoServer/SayHello")
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got error %v, want %q", err, tc.want)
+			}
+		})
+	}
+
+	s := parseExec(map[string]interface{}{
+		"command":    "sleep",
+		"args":       []interface{}{"10"},
+		"env":        map[string]interface{}{},
+		"timeout_ms": 50,
+	}, newTokenCache())
+	if _, err := s.metadata(context.Background(), ""); err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("got error %v, want a timeout", err)
+	}
+}
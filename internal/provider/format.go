@@ -0,0 +1,326 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	formatJSON         = "json"
+	formatTextproto    = "textproto"
+	formatYAML         = "yaml"
+	formatBinaryBase64 = "binary_base64"
+)
+
+var requestFormats = []string{formatJSON, formatTextproto, formatYAML, formatBinaryBase64}
+
+// decodeRequestBody parses body in the given request_format into a new message of type mt
+func decodeRequestBody(format string, body string, mt protoreflect.MessageType) (proto.Message, error) {
+	msg := mt.New().Interface()
+
+	switch format {
+	case formatJSON:
+		// json bodies carry an "@type" key so they are read through an Any
+		a, err := anypb.New(mt.New().Interface())
+		if err != nil {
+			return nil, err
+		}
+		err = protojson.Unmarshal([]byte(body), a)
+		if err != nil {
+			return nil, err
+		}
+		err = proto.Unmarshal(a.Value, msg)
+		if err != nil {
+			return nil, err
+		}
+	case formatTextproto:
+		err := prototext.Unmarshal([]byte(body), msg)
+		if err != nil {
+			return nil, err
+		}
+	case formatYAML:
+		var doc yaml.Node
+		err := yaml.Unmarshal([]byte(body), &doc)
+		if err != nil {
+			return nil, err
+		}
+		root := &doc
+		if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+			root = root.Content[0]
+		}
+		if root.Kind == yaml.MappingNode {
+			// "@type" is optional in yaml; the type always comes from request_type
+			for i := 0; i+1 < len(root.Content); i += 2 {
+				if root.Content[i].Value == "@type" {
+					root.Content = append(root.Content[:i], root.Content[i+2:]...)
+					break
+				}
+			}
+		}
+		err = checkYAMLNode(root, mt.Descriptor())
+		if err != nil {
+			return nil, err
+		}
+		v, err := yamlNodeToInterface(root)
+		if err != nil {
+			return nil, err
+		}
+		jsonBytes, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		err = protojson.Unmarshal(jsonBytes, msg)
+		if err != nil {
+			return nil, err
+		}
+	case formatBinaryBase64:
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(body))
+		if err != nil {
+			return nil, err
+		}
+		err = proto.Unmarshal(b, msg)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported request_format %q", format)
+	}
+	return msg, nil
+}
+
+// checkYAMLNode walks a yaml document against the message descriptor so that
+// unknown fields and obvious type mismatches are reported with their line and column
+func checkYAMLNode(n *yaml.Node, md protoreflect.MessageDescriptor) error {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if isWellKnownJSONType(md) {
+		// well known types have their own json mapping; leave those to protojson
+		return nil
+	}
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		return nil
+	}
+	if n.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d:%d: expected a mapping for message %s", n.Line, n.Column, md.FullName())
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		fd := md.Fields().ByJSONName(k.Value)
+		if fd == nil {
+			fd = md.Fields().ByName(protoreflect.Name(k.Value))
+		}
+		if fd == nil {
+			return fmt.Errorf("line %d:%d: unknown field %q in message %s", k.Line, k.Column, k.Value, md.FullName())
+		}
+		err := checkYAMLField(v, fd)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkYAMLField(n *yaml.Node, fd protoreflect.FieldDescriptor) error {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		return nil
+	}
+	switch {
+	case fd.IsMap():
+		if n.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d:%d: expected a mapping for map field %q", n.Line, n.Column, fd.Name())
+		}
+		for i := 1; i < len(n.Content); i += 2 {
+			err := checkYAMLValue(n.Content[i], fd.MapValue())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case fd.IsList():
+		if n.Kind != yaml.SequenceNode {
+			return fmt.Errorf("line %d:%d: expected a sequence for repeated field %q", n.Line, n.Column, fd.Name())
+		}
+		for _, e := range n.Content {
+			err := checkYAMLValue(e, fd)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return checkYAMLValue(n, fd)
+}
+
+func checkYAMLValue(n *yaml.Node, fd protoreflect.FieldDescriptor) error {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return checkYAMLNode(n, fd.Message())
+	case protoreflect.BoolKind:
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!bool" {
+			return fmt.Errorf("line %d:%d: field %q expects a bool, got %q", n.Line, n.Column, fd.Name(), n.Value)
+		}
+	case protoreflect.StringKind:
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!str" {
+			return fmt.Errorf("line %d:%d: field %q expects a string, got %q (quote the value)", n.Line, n.Column, fd.Name(), n.Value)
+		}
+	case protoreflect.EnumKind:
+		if n.Kind != yaml.ScalarNode {
+			return fmt.Errorf("line %d:%d: field %q expects an enum value", n.Line, n.Column, fd.Name())
+		}
+		if n.Tag == "!!str" && fd.Enum().Values().ByName(protoreflect.Name(n.Value)) == nil && fd.Enum().FullName() != "google.protobuf.NullValue" {
+			return fmt.Errorf("line %d:%d: invalid value %q for enum %s", n.Line, n.Column, n.Value, fd.Enum().FullName())
+		}
+	case protoreflect.BytesKind:
+		if n.Kind != yaml.ScalarNode {
+			return fmt.Errorf("line %d:%d: field %q expects base64 encoded bytes", n.Line, n.Column, fd.Name())
+		}
+	default:
+		// numeric kinds; protojson also accepts numbers as strings
+		if n.Kind != yaml.ScalarNode || (n.Tag != "!!int" && n.Tag != "!!float" && n.Tag != "!!str") {
+			return fmt.Errorf("line %d:%d: field %q expects a number, got %q", n.Line, n.Column, fd.Name(), n.Value)
+		}
+	}
+	return nil
+}
+
+// yamlNodeToInterface converts a yaml node into values encoding/json can marshal
+func yamlNodeToInterface(n *yaml.Node) (interface{}, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return yamlNodeToInterface(n.Content[0])
+	case yaml.AliasNode:
+		return yamlNodeToInterface(n.Alias)
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v, err := yamlNodeToInterface(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[n.Content[i].Value] = v
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		l := make([]interface{}, 0, len(n.Content))
+		for _, c := range n.Content {
+			v, err := yamlNodeToInterface(c)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		return l, nil
+	case yaml.ScalarNode:
+		if n.Tag == "!!int" {
+			// keep 64bit integers exact instead of rounding them through float64
+			var i int64
+			if err := n.Decode(&i); err == nil {
+				return json.Number(strconv.FormatInt(i, 10)), nil
+			}
+			var u uint64
+			if err := n.Decode(&u); err != nil {
+				return nil, fmt.Errorf("line %d:%d: %v", n.Line, n.Column, err)
+			}
+			return json.Number(strconv.FormatUint(u, 10)), nil
+		}
+		if n.Tag == "!!float" {
+			var f float64
+			if err := n.Decode(&f); err != nil {
+				return nil, fmt.Errorf("line %d:%d: %v", n.Line, n.Column, err)
+			}
+			// protojson spells the non finite values as strings
+			switch {
+			case math.IsNaN(f):
+				return "NaN", nil
+			case math.IsInf(f, 1):
+				return "Infinity", nil
+			case math.IsInf(f, -1):
+				return "-Infinity", nil
+			}
+			return f, nil
+		}
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			return nil, fmt.Errorf("line %d:%d: %v", n.Line, n.Column, err)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("line %d:%d: unsupported yaml node", n.Line, n.Column)
+}
+
+// wellKnownJSONTypes have their own protojson representation instead of an object of fields
+var wellKnownJSONTypes = map[protoreflect.FullName]bool{
+	"google.protobuf.Any":         true,
+	"google.protobuf.Timestamp":   true,
+	"google.protobuf.Duration":    true,
+	"google.protobuf.FieldMask":   true,
+	"google.protobuf.Struct":      true,
+	"google.protobuf.Value":       true,
+	"google.protobuf.ListValue":   true,
+	"google.protobuf.BoolValue":   true,
+	"google.protobuf.Int32Value":  true,
+	"google.protobuf.Int64Value":  true,
+	"google.protobuf.UInt32Value": true,
+	"google.protobuf.UInt64Value": true,
+	"google.protobuf.FloatValue":  true,
+	"google.protobuf.DoubleValue": true,
+	"google.protobuf.StringValue": true,
+	"google.protobuf.BytesValue":  true,
+}
+
+// isWellKnownJSONType reports whether md has a special protojson representation
+func isWellKnownJSONType(md protoreflect.MessageDescriptor) bool {
+	return wellKnownJSONTypes[md.FullName()]
+}
+
+// jsonToYAML rewrites a json document as block style yaml
+func jsonToYAML(b []byte) (string, error) {
+	// json is valid yaml so the node tree keeps the original field order
+	var doc yaml.Node
+	err := yaml.Unmarshal(b, &doc)
+	if err != nil {
+		return "", err
+	}
+	resetYAMLStyle(&doc)
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	err = enc.Encode(&doc)
+	if err != nil {
+		return "", err
+	}
+	err = enc.Close()
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func resetYAMLStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		resetYAMLStyle(c)
+	}
+}
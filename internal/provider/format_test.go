@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	echo "github.com/salrashid123/grpc_wireformat/grpc_services/src/echo"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDecodeRequestBody(t *testing.T) {
+	want := &echo.EchoRequest{
+		FirstName:  "sal",
+		LastName:   "mander",
+		MiddleName: &echo.Middle{Name: "a"},
+	}
+	wireBytes, err := proto.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format string
+		body   string
+	}{
+		{formatJSON, `{"@type": "echo.EchoRequest", "firstName": "sal", "last_name": "mander", "middleName": {"name": "a"}}`},
+		{formatTextproto, "first_name: \"sal\"\nlast_name: \"mander\"\nmiddle_name {\n  name: \"a\"\n}\n"},
+		{formatYAML, "first_name: sal\nlastName: mander\nmiddle_name:\n  name: a\n"},
+		{formatYAML, "\"@type\": echo.EchoRequest\nfirst_name: sal\nlast_name: mander\nmiddle_name:\n  name: a\n"},
+		{formatBinaryBase64, base64.StdEncoding.EncodeToString(wireBytes)},
+	}
+
+	mt := want.ProtoReflect().Type()
+	for _, tc := range tests {
+		got, err := decodeRequestBody(tc.format, tc.body, mt)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.format, err)
+		}
+		gotBytes, err := proto.Marshal(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(gotBytes) != string(wireBytes) {
+			t.Errorf("%s: decoded message differs from %v", tc.format, want)
+		}
+	}
+}
+
+func TestDecodeRequestBody_errorPositions(t *testing.T) {
+	tests := []struct {
+		format string
+		body   string
+		want   string
+	}{
+		{formatTextproto, "first_name: \"sal\"\n  lst_name: \"mander\"\n", "line 2:3"},
+		{formatYAML, "first_name: sal\nmiddle_name:\n  nme: a\n", "line 3:3: unknown field \"nme\""},
+		{formatYAML, "first_name: 42\n", "line 1:13: field \"first_name\" expects a string"},
+		{formatJSON, "{\"@type\": \"echo.EchoRequest\",\n \"frist_name\": \"sal\"}", "line 2:2"},
+		{formatBinaryBase64, "not base64!", "illegal base64 data"},
+	}
+
+	mt := (&echo.EchoRequest{}).ProtoReflect().Type()
+	for _, tc := range tests {
+		_, err := decodeRequestBody(tc.format, tc.body, mt)
+		if err == nil {
+			t.Fatalf("%s: expected an error", tc.format)
+		}
+		if !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error %q does not contain %q", tc.format, err, tc.want)
+		}
+	}
+}
+
+func TestJSONToYAML(t *testing.T) {
+	tests := []struct {
+		msg  proto.Message
+		want string
+	}{
+		{&echo.EchoReply{Message: "Hello sal a mander"}, "message: Hello sal a mander\n"},
+		{&echo.EchoReply{Message: "123"}, "message: \"123\"\n"},
+		{&echo.EchoRequest{FirstName: "sal", MiddleName: &echo.Middle{Name: "a"}}, "firstName: sal\nmiddleName:\n  name: a\n"},
+	}
+	for _, tc := range tests {
+		b, err := protojson.Marshal(tc.msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := jsonToYAML(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("jsonToYAML(%v) = %q, want %q", tc.msg, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	engineHTTP2  = "http2"
+	engineGRPCGo = "grpc-go"
+)
+
+var transportEngines = []string{engineHTTP2, engineGRPCGo}
+
+// transportEngineSchema is the transport_engine attribute of the provider, an endpoint or a data source
+func transportEngineSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeString,
+		Optional:     true,
+		ValidateFunc: validation.StringInSlice(transportEngines, false),
+		Description:  "http2 for the built in HTTP/2 client, grpc-go for a grpc.ClientConn, default http2.",
+	}
+}
+
+// rawCodec hands the bytes marshalled with the registry descriptors to grpc-go
+// as they are. grpc-go takes the content-subtype from the name of a forced
+// codec, so it is named proto and calls go out as application/grpc+proto,
+// which every gRPC server accepts.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *v.(*[]byte), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// grpcGoContentType is the content-type grpc-go sends with rawCodec
+var grpcGoContentType = "application/grpc+" + rawCodec{}.Name()
+
+// sniCredentials keeps the server name to the TLS handshake; grpc-go otherwise
+// takes it as the authority and refuses a different :authority, which sni allows
+type sniCredentials struct {
+	credentials.TransportCredentials
+}
+
+func (c sniCredentials) Info() credentials.ProtocolInfo {
+	info := c.TransportCredentials.Info()
+	info.ServerName = ""
+	return info
+}
+
+func (c sniCredentials) Clone() credentials.TransportCredentials {
+	return sniCredentials{c.TransportCredentials.Clone()}
+}
+
+// grpcTarget is the target grpc-go resolves and dials itself; a target behind a
+// proxy, proxy_ca, ssh_tunnel or resolve entry is dialed by the provider through passthrough
+func (t *dialTarget) grpcTarget() (string, bool) {
+	if t.proxy != nil || t.proxyCA != "" || t.tunnel != nil || t.resolved {
+		return "passthrough:///" + t.raw, false
+	}
+	return t.raw, true
+}
+
+// clientConn returns the shared grpc.ClientConn for key and authority, creating it on first use
+func (p *transportPool) clientConn(key transportKey, authority string, target *dialTarget, tlsConfig *tls.Config) (*grpc.ClientConn, error) {
+	fp := key.fingerprint() + " " + authority
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cc, ok := p.conns[fp]; ok {
+		return cc, nil
+	}
+
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.ClientSessionCache = p.sessionCacheFor(key.fingerprint())
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(sniCredentials{credentials.NewTLS(tlsConfig)}),
+		grpc.WithAuthority(authority),
+	}
+	name, native := target.grpcTarget()
+	if !native {
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return target.dial(ctx)
+		}))
+	}
+	if p.settings.IdleTimeout > 0 {
+		opts = append(opts, grpc.WithIdleTimeout(p.settings.IdleTimeout))
+	}
+	if p.settings.InitialWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialWindowSize(int32(p.settings.InitialWindowSize)))
+	}
+	if p.settings.InitialConnWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialConnWindowSize(int32(p.settings.InitialConnWindowSize)))
+	}
+	if p.settings.KeepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    p.settings.KeepaliveTime,
+			Timeout: p.settings.KeepaliveTimeout,
+		}))
+	}
+	cc, err := grpc.NewClient(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.conns[fp] = cc
+	return cc, nil
+}
+
+// streamDesc is the grpc.StreamDesc of the method at path when the registry
+// descriptors declare it streaming, nil for a unary or unknown method
+func streamDesc(path string) *grpc.StreamDesc {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 {
+		return nil
+	}
+	// the last two segments, a url path may carry a routing prefix
+	name := protoreflect.FullName(parts[len(parts)-2] + "." + parts[len(parts)-1])
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		return nil
+	}
+	m, ok := d.(protoreflect.MethodDescriptor)
+	if !ok || (!m.IsStreamingClient() && !m.IsStreamingServer()) {
+		return nil
+	}
+	return &grpc.StreamDesc{StreamName: string(m.Name()), ServerStreams: m.IsStreamingServer(), ClientStreams: m.IsStreamingClient()}
+}
+
+// doGRPCCall sends in to the method at path over cc and returns the response
+// message. Unary methods go through Invoke; a streaming method, desc set, goes
+// through NewStream with in as its only request and, like doCall, the first
+// response message is returned after the stream is read to its end.
+func doGRPCCall(ctx context.Context, cc *grpc.ClientConn, desc *grpc.StreamDesc, authority, path string, timeout time.Duration, headers map[string]string, in []byte, signer requestSigner, limits messageLimits) (*grpcResponse, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	md := metadata.New(headers)
+	if signer != nil {
+		// the signature covers the metadata and framing grpc-go sends, like doCall
+		sent := map[string]string{"content-type": grpcGoContentType, "te": "trailers"}
+		for name, value := range headers {
+			sent[strings.ToLower(name)] = value
+		}
+		sig, err := signer.sign(&signingRequest{
+			Method:    http.MethodPost,
+			Authority: authority,
+			Path:      path,
+			Headers:   sent,
+			Body:      frameMessage(in),
+			Time:      time.Now(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Error signing request: %s", err)
+		}
+		for name, value := range sig {
+			md.Set(name, value)
+		}
+	}
+
+	var header metadata.MD
+	var p peer.Peer
+	var out []byte
+	opts := []grpc.CallOption{
+		grpc.ForceCodec(rawCodec{}), grpc.Header(&header), grpc.Peer(&p),
+		grpc.MaxCallRecvMsgSize(limits.receive()),
+	}
+	if limits.MaxSend > 0 {
+		opts = append(opts, grpc.MaxCallSendMsgSize(limits.MaxSend))
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+	var err error
+	found := true
+	if desc == nil {
+		err = cc.Invoke(ctx, path, &in, &out, opts...)
+	} else {
+		out, found, err = streamCall(ctx, cc, desc, path, in, opts)
+	}
+	if err != nil {
+		st, ok := status.FromError(err)
+		if !ok || (st.Code() == codes.Unavailable && p.Addr == nil) {
+			// no stream was opened on a connection, so no server answered: dial, TLS,
+			// proxy and tunnel failures, which doCall reports the same way
+			return nil, &transportError{err: fmt.Errorf("Error creating grpcCall: %s", err)}
+		}
+		return nil, &grpcStatusError{Code: st.Code(), Message: st.Message()}
+	}
+	if !found {
+		return nil, fmt.Errorf("Error reading respMessageBytes: the response has no message")
+	}
+
+	resp := &grpcResponse{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Message:    out,
+		Conn:       &connectionInfo{remote: p.Addr},
+	}
+	for name, values := range header {
+		resp.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		resp.Conn.state = &info.State
+	}
+	return resp, nil
+}
+
+// streamCall sends in as the only request message of the streaming method at
+// path and returns the first response message, if any
+func streamCall(ctx context.Context, cc *grpc.ClientConn, desc *grpc.StreamDesc, path string, in []byte, opts []grpc.CallOption) ([]byte, bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s, err := cc.NewStream(ctx, desc, path, opts...)
+	if err != nil {
+		return nil, false, err
+	}
+	// io.EOF means the server already ended the stream, RecvMsg returns its status
+	if err := s.SendMsg(&in); err != nil && err != io.EOF {
+		return nil, false, err
+	}
+	if err := s.CloseSend(); err != nil {
+		return nil, false, err
+	}
+	var out []byte
+	found := false
+	for {
+		var msg []byte
+		if err := s.RecvMsg(&msg); err == io.EOF {
+			return out, found, nil
+		} else if err != nil {
+			return nil, false, err
+		}
+		if !found {
+			out, found = msg, true
+		}
+	}
+}
+
+// frameMessage is the gRPC length-prefixed message for in, uncompressed
+func frameMessage(in []byte) []byte {
+	n := len(in)
+	return append([]byte{0, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}, in...)
+}
@@ -0,0 +1,233 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	echo "github.com/salrashid123/grpc_wireformat/grpc_services/src/echo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestRawCodec(t *testing.T) {
+	in := []byte{0x0a, 0x03, 's', 'a', 'l'}
+	b, err := rawCodec{}.Marshal(&in)
+	if err != nil || !bytes.Equal(b, in) {
+		t.Errorf("Marshal = %x, %v", b, err)
+	}
+	var out []byte
+	if err := (rawCodec{}).Unmarshal(b, &out); err != nil || !bytes.Equal(out, in) {
+		t.Errorf("Unmarshal = %x, %v", out, err)
+	}
+	// grpc-go may reuse the buffer it unmarshalled from
+	b[0] = 0
+	if out[0] != 0x0a {
+		t.Error("Unmarshal kept a reference to the received buffer")
+	}
+	if (rawCodec{}).Name() != "proto" {
+		t.Errorf("Name = %q, servers only accept application/grpc and application/grpc+proto", rawCodec{}.Name())
+	}
+}
+
+func TestGRPCTarget(t *testing.T) {
+	for target, want := range map[string]string{
+		"localhost:50051":         "localhost:50051",
+		"dns:///billing.internal": "dns:///billing.internal",
+		"unix:///run/agent.sock":  "unix:///run/agent.sock",
+		"ipv4:10.0.0.1,10.0.0.2":  "ipv4:10.0.0.1,10.0.0.2",
+	} {
+		dt, err := parseTarget(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, native := dt.grpcTarget(); got != want || !native {
+			t.Errorf("grpcTarget(%q) = %q, %t", target, got, native)
+		}
+	}
+
+	dt, _ := parseTarget("billing.internal:443")
+	resolved, err := dt.withResolve(map[string]string{"billing.internal:443": "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxied, _ := parseTarget("billing.internal:443")
+	proxied.proxy, _ = parseProxy("http://proxy:3128")
+	for _, dt := range []*dialTarget{resolved, proxied} {
+		if got, native := dt.grpcTarget(); got != "passthrough:///billing.internal:443" || native {
+			t.Errorf("grpcTarget of a target the provider dials = %q, %t", got, native)
+		}
+	}
+}
+
+func TestClientConnSessionCache(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	in, err := proto.Marshal(&echo.EchoRequest{FirstName: "sal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := parseTarget(testHttpMock.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := newTransportPool(defaultPoolSettings)
+	call := func(k transportKey, tlsConfig *tls.Config) error {
+		cc, err := pool.clientConn(k, testHttpMock.Address, target, tlsConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = doGRPCCall(context.Background(), cc, nil, testHttpMock.Address, "/echo.EchoServer/SayHello", 0, nil, in, nil, messageLimits{})
+		return err
+	}
+
+	// like the http2 transports, a grpc-go connection must not resume a
+	// session from other TLS settings and skip VerifyPeerCertificate
+	if err := call(transportKey{Addr: testHttpMock.Address, SNI: "localhost", InsecureSkipVerify: true}, &tls.Config{InsecureSkipVerify: true, ServerName: "localhost"}); err != nil {
+		t.Fatal(err)
+	}
+	strict := &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         "localhost",
+		VerifyPeerCertificate: func([][]byte, [][]*x509.Certificate) error {
+			return errors.New("not the expected workload")
+		},
+	}
+	err = call(transportKey{Addr: testHttpMock.Address, SNI: "localhost", SPIFFE: "spiffe://example.org/echo"}, strict)
+	if err == nil || !strings.Contains(err.Error(), "not the expected workload") {
+		t.Errorf("got error %v, want the peer certificate checked instead of a resumed session", err)
+	}
+}
+
+func TestStreamDesc(t *testing.T) {
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("streamtest/streamer.proto"),
+		Package:     proto.String("streamtest"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Hello")}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Streamer"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("Hello"), InputType: proto.String(".streamtest.Hello"), OutputType: proto.String(".streamtest.Hello")},
+				{Name: proto.String("List"), InputType: proto.String(".streamtest.Hello"), OutputType: proto.String(".streamtest.Hello"), ServerStreaming: proto.Bool(true)},
+			},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := streamDesc("/streamtest.Streamer/Hello"); d != nil {
+		t.Errorf("unary method got %+v", d)
+	}
+	if d := streamDesc("/streamtest.Streamer/Missing"); d != nil {
+		t.Errorf("unknown method got %+v", d)
+	}
+	for _, path := range []string{"/streamtest.Streamer/List", "/grpc/streamtest.Streamer/List"} {
+		if d := streamDesc(path); d == nil || !d.ServerStreams || d.ClientStreams || d.StreamName != "List" {
+			t.Errorf("streamDesc(%q) = %+v", path, d)
+		}
+	}
+}
+
+// startRawServer serves every method with handler over TLS, messages as raw bytes
+func startRawServer(t *testing.T, handler grpc.StreamHandler) string {
+	td := newTestTrustDomain(t)
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{td.issue(t, "spiffe://example.org/echo", false).tlsCertificate()}})),
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(handler),
+	)
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+	return l.Addr().String()
+}
+
+func TestDoGRPCCall(t *testing.T) {
+	addr := startRawServer(t, func(_ interface{}, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		var in []byte
+		if err := stream.RecvMsg(&in); err != nil {
+			return err
+		}
+		switch method {
+		case "/streamtest.Streamer/List":
+			for _, suffix := range []string{"-1", "-2", "-3"} {
+				out := append(append([]byte(nil), in...), suffix...)
+				if err := stream.SendMsg(&out); err != nil {
+					return err
+				}
+			}
+			return nil
+		case "/streamtest.Streamer/Empty":
+			return nil
+		}
+		return status.Error(codes.Unavailable, "draining")
+	})
+
+	pool := newTransportPool(defaultPoolSettings)
+	connect := func(addr string) *grpc.ClientConn {
+		target, err := parseTarget(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cc, err := pool.clientConn(transportKey{Addr: addr, InsecureSkipVerify: true}, addr, target, &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cc
+	}
+	cc := connect(addr)
+	stream := &grpc.StreamDesc{StreamName: "List", ServerStreams: true}
+	in := []byte("sal")
+
+	// the first message of a server stream, read to its end like doCall
+	resp, err := doGRPCCall(context.Background(), cc, stream, addr, "/streamtest.Streamer/List", 0, nil, in, nil, messageLimits{})
+	if err != nil || string(resp.Message) != "sal-1" {
+		t.Fatalf("streaming call = %+v, %v", resp, err)
+	}
+	if _, err := doGRPCCall(context.Background(), cc, stream, addr, "/streamtest.Streamer/Empty", 0, nil, in, nil, messageLimits{}); err == nil || !strings.Contains(err.Error(), "the response has no message") {
+		t.Errorf("got error %v for a stream without messages", err)
+	}
+
+	// an UNAVAILABLE the server sends is its answer, not a connection failure
+	var statusErr *grpcStatusError
+	var transportErr *transportError
+	_, err = doGRPCCall(context.Background(), cc, nil, addr, "/streamtest.Streamer/Down", 0, nil, in, nil, messageLimits{})
+	if !errors.As(err, &statusErr) || statusErr.Code != codes.Unavailable || errors.As(err, &transportErr) {
+		t.Errorf("got error %#v from a server sending UNAVAILABLE", err)
+	}
+
+	// nothing listens on a closed port, so no server answers
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+	_, err = doGRPCCall(context.Background(), connect(closed), nil, closed, "/streamtest.Streamer/Down", 0, nil, in, nil, messageLimits{})
+	if !errors.As(err, &transportErr) {
+		t.Errorf("got error %#v for a refused connection, want a transportError", err)
+	}
+}
@@ -0,0 +1,281 @@
+package provider
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// jwtReservedClaims are set from the jwt block and can not be overridden by claims
+var jwtReservedClaims = []string{"iss", "sub", "aud", "iat", "exp"}
+
+// jwtSchema is the jwt block of credentials
+func jwtSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"private_key": {
+					Type:        schema.TypeString,
+					Required:    true,
+					Sensitive:   true,
+					Description: "PEM encoded RSA, ECDSA or Ed25519 private key the token is signed with.",
+				},
+				"key_id": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "Sent as the kid header.",
+				},
+				"issuer": {
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				"subject": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "Defaults to issuer.",
+				},
+				"audience": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "Defaults to the service url, eg https://host/echo.EchoServer.",
+				},
+				"lifetime_seconds": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Default:      3600,
+					ValidateFunc: validation.IntAtLeast(1),
+				},
+				"claims": {
+					Type:     schema.TypeMap,
+					Optional: true,
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+					Description: "Extra string claims added to the token.",
+				},
+			},
+		},
+	}
+}
+
+// jwtSource signs its own tokens with a local private key, one per audience
+type jwtSource struct {
+	key       crypto.Signer
+	alg       string
+	keyID     string
+	issuer    string
+	subject   string
+	audience  string
+	lifetime  time.Duration
+	claims    map[string]string
+	keyDigest string
+	tokens    *tokenCache
+}
+
+func parseJWT(c map[string]interface{}, tokens *tokenCache) (*jwtSource, error) {
+	key, alg, err := parseSigningKey(c["private_key"].(string))
+	if err != nil {
+		return nil, fmt.Errorf("jwt private_key: %v", err)
+	}
+	s := &jwtSource{
+		key:      key,
+		alg:      alg,
+		keyID:    c["key_id"].(string),
+		issuer:   c["issuer"].(string),
+		subject:  c["subject"].(string),
+		audience: c["audience"].(string),
+		lifetime: time.Duration(c["lifetime_seconds"].(int)) * time.Second,
+		claims:   map[string]string{},
+		tokens:   tokens,
+	}
+	if s.subject == "" {
+		s.subject = s.issuer
+	}
+	for k, v := range c["claims"].(map[string]interface{}) {
+		for _, r := range jwtReservedClaims {
+			if k == r {
+				return nil, fmt.Errorf("jwt claim %q is set from the jwt block", k)
+			}
+		}
+		s.claims[k] = v.(string)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, fmt.Errorf("jwt private_key: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	s.keyDigest = hex.EncodeToString(sum[:])
+	return s, nil
+}
+
+// parseSigningKey reads a PKCS#8, PKCS#1 or SEC 1 private key and picks the JWS algorithm for it
+func parseSigningKey(pemKey string) (crypto.Signer, string, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, "", fmt.Errorf("no PEM block found")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, "", fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, "RS256", nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return k, "ES256", nil
+		case elliptic.P384():
+			return k, "ES384", nil
+		case elliptic.P521():
+			return k, "ES512", nil
+		}
+		return nil, "", fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+	case ed25519.PrivateKey:
+		return k, "EdDSA", nil
+	}
+	return nil, "", fmt.Errorf("unsupported key type %T", key)
+}
+
+func (s *jwtSource) metadata(_ context.Context, rawURL string) (map[string]string, error) {
+	aud := s.audience
+	if aud == "" {
+		var err error
+		if aud, err = serviceAudience(rawURL); err != nil {
+			return nil, err
+		}
+	}
+	token, err := s.tokens.get(s.cacheKey(aud), func() (*cachedToken, error) {
+		signed, err := s.sign(aud, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return newCachedToken("Bearer "+signed, s.lifetime), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": token.value}, nil
+}
+
+// cacheKey identifies the token by its key and claims; the private key itself is not part of it
+func (s *jwtSource) cacheKey(aud string) string {
+	claims, _ := json.Marshal(s.claims)
+	h := sha256.New()
+	fmt.Fprintf(h, "jwt\n%q\n%q\n%q\n%q\n%q\n%s\n%s\n", s.keyDigest, s.keyID, s.issuer, s.subject, aud, s.lifetime, claims)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// sign returns a compact JWS issued at now for aud
+func (s *jwtSource) sign(aud string, now time.Time) (string, error) {
+	header := map[string]string{"alg": s.alg, "typ": "JWT"}
+	if s.keyID != "" {
+		header["kid"] = s.keyID
+	}
+	claims := map[string]interface{}{}
+	for k, v := range s.claims {
+		claims[k] = v
+	}
+	claims["iss"] = s.issuer
+	claims["sub"] = s.subject
+	claims["aud"] = aud
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(s.lifetime).Unix()
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	sig, err := s.signature([]byte(signingInput))
+	if err != nil {
+		return "", fmt.Errorf("signing jwt: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func (s *jwtSource) signature(in []byte) ([]byte, error) {
+	switch k := s.key.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, in), nil
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256(in)
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+	case *ecdsa.PrivateKey:
+		var digest []byte
+		switch s.alg {
+		case "ES256":
+			sum := sha256.Sum256(in)
+			digest = sum[:]
+		case "ES384":
+			sum := sha512.Sum384(in)
+			digest = sum[:]
+		default:
+			sum := sha512.Sum512(in)
+			digest = sum[:]
+		}
+		r, ss, err := ecdsa.Sign(rand.Reader, k, digest)
+		if err != nil {
+			return nil, err
+		}
+		// JWS wants the fixed size r || s, not ASN.1
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig := make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		ss.FillBytes(sig[size:])
+		return sig, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", s.key)
+}
+
+// serviceAudience is the default audience for a call to rawURL, the scheme,
+// host and service without the method, eg https://billing.internal/billing.Ledger
+func serviceAudience(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	host := strings.TrimSuffix(u.Host, ":443")
+	service := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)[0]
+	return "https://" + host + "/" + service, nil
+}
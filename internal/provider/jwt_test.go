@@ -0,0 +1,228 @@
+package provider
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testJWTConfig(pemKey string) map[string]interface{} {
+	return map[string]interface{}{
+		"private_key":      pemKey,
+		"key_id":           "key-1",
+		"issuer":           "terraform@example.com",
+		"subject":          "",
+		"audience":         "",
+		"lifetime_seconds": 600,
+		"claims":           map[string]interface{}{"team": "billing"},
+	}
+}
+
+func pemEncode(t *testing.T, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// verifyJWT checks the signature of token with pub and returns its header and claims
+func verifyJWT(t *testing.T, token string, pub crypto.PublicKey) (map[string]interface{}, map[string]interface{}) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("%q is not a compact JWS", token)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := []byte(parts[0] + "." + parts[1])
+
+	ok := false
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, in, sig)
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(in)
+		ok = rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch k.Curve {
+		case elliptic.P256():
+			sum := sha256.Sum256(in)
+			digest = sum[:]
+		default:
+			sum := sha512.Sum384(in)
+			digest = sum[:]
+		}
+		size := len(sig) / 2
+		ok = ecdsa.Verify(k, digest, new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:]))
+	}
+	if !ok {
+		t.Fatalf("signature of %q does not verify", token)
+	}
+
+	var header, claims map[string]interface{}
+	for i, v := range []*map[string]interface{}{&header, &claims} {
+		b, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(b, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return header, claims
+}
+
+func TestJWTSource(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		pem  string
+		pub  crypto.PublicKey
+		alg  string
+	}{
+		{"rsa pkcs8", pemEncode(t, rsaKey), &rsaKey.PublicKey, "RS256"},
+		{"rsa pkcs1", string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})), &rsaKey.PublicKey, "RS256"},
+		{"ecdsa sec1", string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER})), &ecKey.PublicKey, "ES256"},
+		{"ecdsa p384", pemEncode(t, ec384Key), &ec384Key.PublicKey, "ES384"},
+		{"ed25519", pemEncode(t, edKey), edKey.Public(), "EdDSA"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens := newTokenCache()
+			creds, err := parseCredentials([]interface{}{map[string]interface{}{
+				"client_credentials": []interface{}{},
+				"token_exchange":     []interface{}{},
+				"jwt":                []interface{}{testJWTConfig(tc.pem)},
+				"exec":               []interface{}{},
+				"spiffe_jwt":         []interface{}{},
+			}}, tokens)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			before := time.Now().Unix()
+			md, err := creds.metadata(context.Background(), "https://billing.internal:443/billing.Ledger/Post")
+			if err != nil {
+				t.Fatal(err)
+			}
+			auth := md["authorization"]
+			if !strings.HasPrefix(auth, "Bearer ") {
+				t.Fatalf("authorization = %q", auth)
+			}
+			header, claims := verifyJWT(t, strings.TrimPrefix(auth, "Bearer "), tc.pub)
+			if header["alg"] != tc.alg || header["kid"] != "key-1" || header["typ"] != "JWT" {
+				t.Errorf("header = %v", header)
+			}
+			if claims["iss"] != "terraform@example.com" || claims["sub"] != "terraform@example.com" || claims["team"] != "billing" {
+				t.Errorf("claims = %v", claims)
+			}
+			if claims["aud"] != "https://billing.internal/billing.Ledger" {
+				t.Errorf("aud = %v", claims["aud"])
+			}
+			iat, exp := int64(claims["iat"].(float64)), int64(claims["exp"].(float64))
+			if iat < before || exp-iat != 600 {
+				t.Errorf("iat = %d, exp = %d", iat, exp)
+			}
+
+			// the same audience reuses the token, another audience gets its own
+			again, err := creds.metadata(context.Background(), "https://billing.internal/billing.Ledger/Get")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again["authorization"] != auth {
+				t.Error("token was not reused for the same audience")
+			}
+			other, err := creds.metadata(context.Background(), "https://billing.internal/billing.Audit/Get")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if other["authorization"] == auth || len(tokens.tokens) != 2 {
+				t.Error("token was reused for another audience")
+			}
+		})
+	}
+}
+
+func TestParseJWTErrors(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+		want   string
+	}{
+		{"not pem", testJWTConfig("not a key"), "no PEM block found"},
+		{"certificate", testJWTConfig(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}}))), `unsupported PEM block "CERTIFICATE"`},
+		{"reserved claim", func() map[string]interface{} {
+			c := testJWTConfig(pemEncode(t, edKey))
+			c["claims"] = map[string]interface{}{"aud": "x"}
+			return c
+		}(), `jwt claim "aud" is set from the jwt block`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseJWT(tc.config, newTokenCache())
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestServiceAudience(t *testing.T) {
+	tests := map[string]string{
+		"https://localhost:8081/echo.EchoServer/SayHello":  "https://localhost:8081/echo.EchoServer",
+		"https://billing.internal:443/billing.Ledger/Post": "https://billing.internal/billing.Ledger",
+		"https://billing.internal/billing.Ledger/Post":     "https://billing.internal/billing.Ledger",
+		"https://[::1]:443/billing.Ledger/Post":            "https://[::1]/billing.Ledger",
+	}
+	for in, want := range tests {
+		got, err := serviceAudience(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("serviceAudience(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
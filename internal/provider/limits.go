@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// callLimiter caps the calls in flight and the rate calls are sent at
+type callLimiter struct {
+	maxConcurrent int
+	slots         chan struct{}
+	rate          *rate.Limiter
+}
+
+// newCallLimiter returns a limiter allowing maxConcurrent calls in flight and
+// callsPerSecond calls with bursts of burst; zero disables either limit
+func newCallLimiter(maxConcurrent int, callsPerSecond float64, burst int) *callLimiter {
+	l := &callLimiter{maxConcurrent: maxConcurrent}
+	if maxConcurrent > 0 {
+		l.slots = make(chan struct{}, maxConcurrent)
+	}
+	if callsPerSecond > 0 {
+		if burst < 1 {
+			burst = 1
+		}
+		l.rate = rate.NewLimiter(rate.Limit(callsPerSecond), burst)
+	}
+	return l
+}
+
+// overlay returns l with max_concurrent_calls and rate_limit replaced when get
+// has a value for them, 0 for no limit; a limit that is not set keeps the slots
+// or token bucket of l, so calls through either limiter count against it.
+// rate_limit_burst applies with rate_limit and defaults to burst.
+func (l *callLimiter) overlay(get tlsSettingsGetter, burst int) *callLimiter {
+	maxConcurrent, hasMax := get("max_concurrent_calls")
+	callsPerSecond, hasRate := get("rate_limit")
+	if !hasMax && !hasRate {
+		return l
+	}
+	o := &callLimiter{maxConcurrent: l.maxConcurrent, slots: l.slots, rate: l.rate}
+	if hasMax {
+		own := newCallLimiter(maxConcurrent.(int), 0, 0)
+		o.maxConcurrent, o.slots = own.maxConcurrent, own.slots
+	}
+	if hasRate {
+		if v, ok := get("rate_limit_burst"); ok {
+			burst = v.(int)
+		}
+		o.rate = newCallLimiter(0, callsPerSecond.(float64), burst).rate
+	}
+	return o
+}
+
+// acquire blocks until a call to url may be sent and returns the func that
+// releases its max_concurrent_calls slot once the call is done
+func (l *callLimiter) acquire(ctx context.Context, url string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	release := func() {}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			log.Printf("[INFO] grpc call to %s blocked, max_concurrent_calls (%d) are in flight", url, l.maxConcurrent)
+			start := time.Now()
+			select {
+			case l.slots <- struct{}{}:
+				log.Printf("[INFO] grpc call to %s unblocked after %s", url, time.Since(start))
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		release = func() { <-l.slots }
+	}
+
+	if l.rate != nil {
+		r := l.rate.Reserve()
+		if delay := r.Delay(); delay > 0 {
+			log.Printf("[INFO] grpc call to %s blocked for %s by rate_limit", url, delay)
+			t := time.NewTimer(delay)
+			defer t.Stop()
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				r.Cancel()
+				release()
+				return nil, ctx.Err()
+			}
+		}
+	}
+	return release, nil
+}
@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCallLimiter_concurrency(t *testing.T) {
+	l := newCallLimiter(2, 0, 0)
+	ctx := context.Background()
+
+	release1, err := l.acquire(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.acquire(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a third call blocks until a slot is released
+	blocked, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(blocked, "c"); err == nil {
+		t.Fatal("expected the third call to block")
+	}
+
+	release1()
+	if _, err := l.acquire(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCallLimiter_rate(t *testing.T) {
+	l := newCallLimiter(0, 20, 1)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := l.acquire(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	// one call from the burst, then two at 50ms intervals
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 calls at 20/s took %s", elapsed)
+	}
+}
+
+func TestCallLimiter_unlimited(t *testing.T) {
+	var l *callLimiter
+	release, err := l.acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	l = newCallLimiter(0, 0, 0)
+	for i := 0; i < 100; i++ {
+		if _, err := l.acquire(context.Background(), "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCallLimiter_overlay(t *testing.T) {
+	provider := newCallLimiter(1, 20, 1)
+	ctx := context.Background()
+
+	if l := provider.overlay(mapGetter(map[string]interface{}{}), 1); l != provider {
+		t.Error("an endpoint without limits got a limiter of its own")
+	}
+
+	// an endpoint setting only a rate keeps counting against the provider max_concurrent_calls
+	endpoint := provider.overlay(mapGetter(map[string]interface{}{"rate_limit": 1000.0}), 1)
+	if _, err := provider.acquire(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	blocked, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := endpoint.acquire(blocked, "b"); err == nil {
+		t.Fatal("expected the endpoint call to wait for the provider slot")
+	}
+
+	// one setting only max_concurrent_calls takes tokens from the provider bucket
+	endpoint = provider.overlay(mapGetter(map[string]interface{}{"max_concurrent_calls": 5}), 1)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := endpoint.acquire(ctx, "c")
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 calls through the shared 20/s bucket took %s", elapsed)
+	}
+	if endpoint.slots == provider.slots {
+		t.Error("endpoint max_concurrent_calls shares the provider slots")
+	}
+
+	// 0 turns a provider limit off for the endpoint
+	endpoint = provider.overlay(mapGetter(map[string]interface{}{"max_concurrent_calls": 0, "rate_limit": 0.0}), 1)
+	if endpoint.slots != nil || endpoint.rate != nil {
+		t.Errorf("endpoint limits set to 0 = %+v", endpoint)
+	}
+	endpoint = provider.overlay(mapGetter(map[string]interface{}{"rate_limit": 5.0, "rate_limit_burst": 4}), 1)
+	if endpoint.rate.Burst() != 4 || endpoint.slots != provider.slots {
+		t.Errorf("endpoint rate limit = %+v", endpoint)
+	}
+}
@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"google.golang.org/grpc/codes"
+)
+
+// noReceiveLimit is the largest message an int holds on every platform, so without
+// max_receive_message_bytes any response is read, as before the limit existed
+const noReceiveLimit = math.MaxInt32
+
+// messageSizeSchema is a max_receive_message_bytes or max_send_message_bytes
+// attribute of the provider, an endpoint or a data source
+func messageSizeSchema(description string) *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeInt,
+		Optional:     true,
+		ValidateFunc: validation.IntAtLeast(0),
+		Description:  description,
+	}
+}
+
+// messageLimits are the largest messages a call receives and sends, 0 for the default
+type messageLimits struct {
+	MaxReceive int
+	MaxSend    int
+}
+
+// overlay returns l with every limit get has a value for replaced, 0 for none
+func (l messageLimits) overlay(get tlsSettingsGetter) messageLimits {
+	if v, ok := get("max_receive_message_bytes"); ok {
+		l.MaxReceive = v.(int)
+	}
+	if v, ok := get("max_send_message_bytes"); ok {
+		l.MaxSend = v.(int)
+	}
+	return l
+}
+
+// receive is the receive limit, none unless set
+func (l messageLimits) receive() int {
+	if l.MaxReceive > 0 {
+		return l.MaxReceive
+	}
+	return noReceiveLimit
+}
+
+// checkSend fails like grpc-go with RESOURCE_EXHAUSTED when in is over the send limit
+func (l messageLimits) checkSend(in []byte) error {
+	if l.MaxSend > 0 && len(in) > l.MaxSend {
+		return &grpcStatusError{
+			Code:    codes.ResourceExhausted,
+			Message: fmt.Sprintf("trying to send message larger than max (%d vs. %d)", len(in), l.MaxSend),
+		}
+	}
+	return nil
+}
+
+// readMessage reads the next length-prefixed message from r; the length is
+// checked against max before anything is allocated. It returns io.EOF when r
+// ends between messages.
+func readMessage(r io.Reader, max int) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("response ended inside a message prefix")
+		}
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		// no grpc-encoding is offered, so a server has no business compressing
+		return nil, &grpcStatusError{Code: codes.Internal, Message: "grpc: compressed response message without a grpc-encoding"}
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if uint64(length) > uint64(max) {
+		return nil, &grpcStatusError{
+			Code:    codes.ResourceExhausted,
+			Message: fmt.Sprintf("grpc: received message larger than max (%d vs. %d)", length, max),
+		}
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("reading a %d byte message: %s", length, err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestReadMessage(t *testing.T) {
+	body := bytes.NewReader(append(frameMessage([]byte("hello")), frameMessage(nil)...))
+	if msg, err := readMessage(body, 16); err != nil || string(msg) != "hello" {
+		t.Errorf("first message = %q, %v", msg, err)
+	}
+	if msg, err := readMessage(body, 16); err != nil || len(msg) != 0 {
+		t.Errorf("empty message = %q, %v", msg, err)
+	}
+	if _, err := readMessage(body, 16); err != io.EOF {
+		t.Errorf("got %v at the end of the body, want io.EOF", err)
+	}
+
+	// a prefix claiming 4 GiB fails before anything is allocated or read
+	var statusErr *grpcStatusError
+	_, err := readMessage(bytes.NewReader([]byte{0, 0xff, 0xff, 0xff, 0xff}), 4<<20)
+	if !errors.As(err, &statusErr) || statusErr.Code != codes.ResourceExhausted || !strings.Contains(statusErr.Message, "(4294967295 vs. 4194304)") {
+		t.Errorf("got error %v for an oversized message", err)
+	}
+
+	if _, err := readMessage(bytes.NewReader([]byte{1, 0, 0, 0, 1, 'x'}), 16); !errors.As(err, &statusErr) || statusErr.Code != codes.Internal {
+		t.Errorf("got error %v for a compressed message", err)
+	}
+	if _, err := readMessage(bytes.NewReader(frameMessage([]byte("hello"))[:7]), 16); err == nil || !strings.Contains(err.Error(), "unexpected EOF") {
+		t.Errorf("got error %v for a truncated message", err)
+	}
+	if _, err := readMessage(bytes.NewReader([]byte{0, 0}), 16); err == nil || err == io.EOF {
+		t.Errorf("got error %v for a truncated prefix", err)
+	}
+}
+
+func TestMessageLimits(t *testing.T) {
+	provider := messageLimits{}.overlay(mapGetter(map[string]interface{}{"max_receive_message_bytes": 1 << 20, "max_send_message_bytes": 32}))
+	if provider.receive() != 1<<20 || provider.MaxSend != 32 {
+		t.Errorf("provider limits = %+v", provider)
+	}
+	// an unset limit keeps the one it is layered over, 0 turns it off
+	endpoint := provider.overlay(mapGetter(map[string]interface{}{"max_send_message_bytes": 64}))
+	if endpoint.receive() != 1<<20 || endpoint.MaxSend != 64 {
+		t.Errorf("endpoint limits = %+v", endpoint)
+	}
+	if unlimited := provider.overlay(mapGetter(map[string]interface{}{"max_receive_message_bytes": 0})); unlimited.receive() != noReceiveLimit {
+		t.Errorf("max_receive_message_bytes = 0 kept %d", unlimited.receive())
+	}
+	// no limit by default, like before max_receive_message_bytes
+	if got := (messageLimits{}).receive(); got != math.MaxInt32 {
+		t.Errorf("default receive limit = %d", got)
+	}
+
+	if err := endpoint.checkSend(make([]byte, 64)); err != nil {
+		t.Errorf("checkSend at the limit: %v", err)
+	}
+	var statusErr *grpcStatusError
+	if err := endpoint.checkSend(make([]byte, 65)); !errors.As(err, &statusErr) || statusErr.Code != codes.ResourceExhausted {
+		t.Errorf("checkSend over the limit: %v", err)
+	}
+	if err := (messageLimits{}).checkSend(make([]byte, 8<<20)); err != nil {
+		t.Errorf("checkSend without a limit: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// pinsSchema is the pinned_spki_sha256 attribute of the provider, an endpoint or a data source
+func pinsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		Elem: &schema.Schema{
+			Type:             schema.TypeString,
+			ValidateDiagFunc: validatePin,
+		},
+		Description: "Base64 SHA-256 hashes of the SubjectPublicKeyInfo, one of which the verified chain, or the leaf, must match.",
+	}
+}
+
+// decodePin accepts a base64 pin, as printed in errors, or a hex one
+func decodePin(pin string) ([]byte, error) {
+	pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+	if b, err := base64.StdEncoding.DecodeString(pin); err == nil && len(b) == sha256.Size {
+		return b, nil
+	}
+	if b, err := hex.DecodeString(pin); err == nil && len(b) == sha256.Size {
+		return b, nil
+	}
+	return nil, fmt.Errorf("%q is not a base64 or hex SHA-256 hash", pin)
+}
+
+func validatePin(v interface{}, path cty.Path) diag.Diagnostics {
+	pin, ok := v.(string)
+	if !ok {
+		return nil
+	}
+	if _, err := decodePin(pin); err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid pinned_spki_sha256",
+			Detail:        err.Error(),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
+
+// parsePins normalizes the pins to base64 so equal pins share connections
+func parsePins(raw []interface{}) ([]string, error) {
+	var pins []string
+	for _, p := range raw {
+		b, err := decodePin(p.(string))
+		if err != nil {
+			return nil, err
+		}
+		pins = append(pins, base64.StdEncoding.EncodeToString(b))
+	}
+	return pins, nil
+}
+
+// spkiPin is the base64 SHA-256 of the certificate public key
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// verifyPins returns a VerifyConnection callback that requires a pin to match
+// a certificate of a verified chain, or with insecure_skip_verify the leaf;
+// the other certificates a server sends are not bound to its key and anyone
+// can append a pinned one to their own leaf
+func verifyPins(pins []string) func(tls.ConnectionState) error {
+	allowed := map[string]bool{}
+	for _, p := range pins {
+		allowed[p] = true
+	}
+	return func(cs tls.ConnectionState) error {
+		chains := cs.VerifiedChains
+		if len(chains) == 0 && len(cs.PeerCertificates) > 0 {
+			chains = [][]*x509.Certificate{cs.PeerCertificates[:1]}
+		}
+		var observed []string
+		seen := map[string]bool{}
+		for _, chain := range chains {
+			for _, cert := range chain {
+				pin := spkiPin(cert)
+				if allowed[pin] {
+					return nil
+				}
+				if !seen[pin] {
+					seen[pin] = true
+					observed = append(observed, fmt.Sprintf("%s (%s)", pin, cert.Subject))
+				}
+			}
+		}
+		return fmt.Errorf("no server certificate matches pinned_spki_sha256, the server sent %s", strings.Join(observed, ", "))
+	}
+}
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func testLocalhostPin(t *testing.T) (string, *x509.Certificate) {
+	block, _ := pem.Decode([]byte(localhostCert))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spkiPin(cert), cert
+}
+
+func TestDecodePin(t *testing.T) {
+	sum := sha256.Sum256([]byte("key"))
+	b64 := base64.StdEncoding.EncodeToString(sum[:])
+	for _, in := range []string{b64, "sha256/" + b64, hex.EncodeToString(sum[:]), " " + b64 + "\n"} {
+		b, err := decodePin(in)
+		if err != nil {
+			t.Errorf("decodePin(%q): %v", in, err)
+			continue
+		}
+		if base64.StdEncoding.EncodeToString(b) != b64 {
+			t.Errorf("decodePin(%q) = %x", in, b)
+		}
+	}
+	for _, in := range []string{"", "abc", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := decodePin(in); err == nil {
+			t.Errorf("decodePin(%q) did not fail", in)
+		}
+	}
+
+	pins, err := parsePins([]interface{}{hex.EncodeToString(sum[:])})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0] != b64 {
+		t.Errorf("parsePins = %v, want base64 pins", pins)
+	}
+}
+
+func TestVerifyPins(t *testing.T) {
+	pin, cert := testLocalhostPin(t)
+	cs := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+
+	if err := verifyPins([]string{"AAAA", pin})(cs); err != nil {
+		t.Errorf("matching pin: %v", err)
+	}
+	err := verifyPins([]string{"AAAA"})(cs)
+	if err == nil || !strings.Contains(err.Error(), pin) || !strings.Contains(err.Error(), cert.Subject.String()) {
+		t.Errorf("got error %v, want the observed pin %s", err, pin)
+	}
+
+	// without chain verification only the leaf counts, a pinned certificate
+	// appended after an impostor leaf does not
+	impostor := newTestTrustDomain(t).issue(t, "spiffe://example.org/impostor", false)
+	appended := tls.ConnectionState{PeerCertificates: []*x509.Certificate{impostor.cert, cert}}
+	if err := verifyPins([]string{pin})(appended); err == nil || strings.Contains(err.Error(), pin) {
+		t.Errorf("got error %v for a pinned certificate after an impostor leaf", err)
+	}
+
+	// with chain verification any certificate of a verified chain may be pinned
+	td := newTestTrustDomain(t)
+	leaf := td.issue(t, "spiffe://example.org/echo", false)
+	verified := tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{leaf.cert, cert},
+		VerifiedChains:   [][]*x509.Certificate{{leaf.cert, td.cert}},
+	}
+	if err := verifyPins([]string{spkiPin(td.cert)})(verified); err != nil {
+		t.Errorf("pinned issuer of the verified chain: %v", err)
+	}
+	if err := verifyPins([]string{pin})(verified); err == nil {
+		t.Errorf("a certificate outside the verified chain matched a pin")
+	}
+}
@@ -0,0 +1,352 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+)
+
+// connectionPoolSchema is the connection_pool block of the provider
+func connectionPoolSchema() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"max_connections": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      defaultPoolSettings.MaxConnections,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Connections opened per target and TLS settings, 0 for no limit.",
+			},
+			"idle_timeout_ms": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      int(defaultPoolSettings.IdleTimeout / time.Millisecond),
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Close connections without streams after this long, 0 to keep them open.",
+			},
+			"keepalive_time_ms": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      int(defaultPoolSettings.KeepaliveTime / time.Millisecond),
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Send a PING when nothing was received for this long, 0 to disable.",
+			},
+			"keepalive_timeout_ms": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      int(defaultPoolSettings.KeepaliveTimeout / time.Millisecond),
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Close the connection when a PING is not answered in time.",
+			},
+			"initial_window_size": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.Any(validation.IntInSlice([]int{0}), validation.IntBetween(minWindowSize, math.MaxInt32)),
+				Description:  "HTTP/2 flow control window of each stream in bytes, 0 for the engine default.",
+			},
+			"initial_conn_window_size": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.Any(validation.IntInSlice([]int{0}), validation.IntBetween(minWindowSize, math.MaxInt32)),
+				Description:  "HTTP/2 flow control window of each connection in bytes, 0 for the engine default.",
+			},
+			"tls_session_cache_size": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      defaultPoolSettings.TLSSessionCacheSize,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "TLS sessions kept for resumption per target and TLS settings, 0 to disable.",
+			},
+		},
+	}
+}
+
+// minWindowSize is the smallest HTTP/2 flow control window, the protocol default
+const minWindowSize = 65535
+
+// poolSettings are the connection_pool settings
+type poolSettings struct {
+	MaxConnections        int
+	IdleTimeout           time.Duration
+	KeepaliveTime         time.Duration
+	KeepaliveTimeout      time.Duration
+	InitialWindowSize     int
+	InitialConnWindowSize int
+	TLSSessionCacheSize   int
+}
+
+var defaultPoolSettings = poolSettings{
+	MaxConnections:      4,
+	IdleTimeout:         90 * time.Second,
+	KeepaliveTime:       0,
+	KeepaliveTimeout:    15 * time.Second,
+	TLSSessionCacheSize: 64,
+}
+
+func parsePoolSettings(d *schema.ResourceData) poolSettings {
+	settings := defaultPoolSettings
+	if p := d.Get("connection_pool").([]interface{}); len(p) > 0 && p[0] != nil {
+		c := p[0].(map[string]interface{})
+		settings.MaxConnections = c["max_connections"].(int)
+		settings.IdleTimeout = time.Duration(c["idle_timeout_ms"].(int)) * time.Millisecond
+		settings.KeepaliveTime = time.Duration(c["keepalive_time_ms"].(int)) * time.Millisecond
+		settings.KeepaliveTimeout = time.Duration(c["keepalive_timeout_ms"].(int)) * time.Millisecond
+		settings.InitialWindowSize = c["initial_window_size"].(int)
+		settings.InitialConnWindowSize = c["initial_conn_window_size"].(int)
+		settings.TLSSessionCacheSize = c["tls_session_cache_size"].(int)
+	}
+	return settings
+}
+
+// transportKey is everything that decides whether two reads may share a connection
+type transportKey struct {
+	Addr               string
+	SNI                string
+	CA                 string
+	InsecureSkipVerify bool
+	SPIFFE             string
+	Pins               string
+	TLS                string
+}
+
+// fingerprint hashes the key so CA bundles and credentials are not kept around as map keys
+func (k transportKey) fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q\n%q\n%q\n%t\n%q\n%q\n%q\n", k.Addr, k.SNI, k.CA, k.InsecureSkipVerify, k.SPIFFE, k.Pins, k.TLS)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// transportPool hands out one http2.Transport per transportKey so reads against
+// the same target multiplex their calls over shared connections
+type transportPool struct {
+	settings poolSettings
+
+	mu            sync.Mutex
+	transports    map[string]*http2.Transport
+	conns         map[string]*grpc.ClientConn
+	sessionCaches map[string]tls.ClientSessionCache
+}
+
+func newTransportPool(settings poolSettings) *transportPool {
+	return &transportPool{
+		settings:      settings,
+		transports:    map[string]*http2.Transport{},
+		conns:         map[string]*grpc.ClientConn{},
+		sessionCaches: map[string]tls.ClientSessionCache{},
+	}
+}
+
+// sessionCacheFor is the TLS session cache for the transportKey fingerprint fp.
+// Sessions are looked up by server name only and a resumed one skips
+// VerifyPeerCertificate, so a session set up under looser trust settings must
+// never be offered by a connection with stricter ones. Call with p.mu held.
+func (p *transportPool) sessionCacheFor(fp string) tls.ClientSessionCache {
+	if p.settings.TLSSessionCacheSize == 0 {
+		return nil
+	}
+	c, ok := p.sessionCaches[fp]
+	if !ok {
+		c = tls.NewLRUClientSessionCache(p.settings.TLSSessionCacheSize)
+		p.sessionCaches[fp] = c
+	}
+	return c
+}
+
+// transport returns the shared transport for key, creating it with target and tlsConfig on first use
+func (p *transportPool) transport(key transportKey, target *dialTarget, tlsConfig *tls.Config) *http2.Transport {
+	fp := key.fingerprint()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.transports[fp]; ok {
+		return t
+	}
+
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.ClientSessionCache = p.sessionCacheFor(fp)
+	tlsConfig.NextProtos = []string{http2.NextProtoTLS}
+
+	t := newHTTP2Transport(p.settings)
+	t.TLSClientConfig = tlsConfig
+	// wait for a free stream instead of failing when a connection is full
+	t.StrictMaxConcurrentStreams = true
+	t.IdleConnTimeout = p.settings.IdleTimeout
+	t.ReadIdleTimeout = p.settings.KeepaliveTime
+	t.PingTimeout = p.settings.KeepaliveTimeout
+	t.ConnPool = &connPool{
+		t:       t,
+		target:  target,
+		tls:     tlsConfig,
+		max:     p.settings.MaxConnections,
+		conns:   map[string][]*http2.ClientConn{},
+		dialing: map[string]int{},
+		dialed:  map[string]chan struct{}{},
+	}
+	p.transports[fp] = t
+	return t
+}
+
+// newHTTP2Transport returns a transport with the flow control windows of settings;
+// x/net only takes them from the net/http Transport it is configured on
+func newHTTP2Transport(settings poolSettings) *http2.Transport {
+	if settings.InitialWindowSize == 0 && settings.InitialConnWindowSize == 0 {
+		return &http2.Transport{}
+	}
+	t1 := &http.Transport{
+		HTTP2: &http.HTTP2Config{
+			MaxReceiveBufferPerStream:     settings.InitialWindowSize,
+			MaxReceiveBufferPerConnection: settings.InitialConnWindowSize,
+		},
+	}
+	t, err := http2.ConfigureTransports(t1)
+	if err != nil {
+		// only a t1 that already speaks h2 is refused
+		return &http2.Transport{}
+	}
+	return t
+}
+
+// connPool is an http2.ClientConnPool that caps the connections per address
+type connPool struct {
+	t      *http2.Transport
+	target *dialTarget
+	tls    *tls.Config
+	max    int
+
+	mu      sync.Mutex
+	conns   map[string][]*http2.ClientConn
+	dialing map[string]int
+	// dialed is closed when a dial for the address finishes
+	dialed map[string]chan struct{}
+}
+
+func (p *connPool) GetClientConn(req *http.Request, addr string) (*http2.ClientConn, error) {
+	for {
+		p.mu.Lock()
+		live := p.conns[addr][:0]
+		for _, cc := range p.conns[addr] {
+			if st := cc.State(); !st.Closed && !st.Closing {
+				live = append(live, cc)
+			}
+		}
+		p.conns[addr] = live
+
+		// streams are not reserved here: in strict mode a reservation is only released
+		// once the stream starts, so queued reservations would block each other
+		var leastLoaded *http2.ClientConn
+		leastLoad := 0
+		for _, cc := range live {
+			st := cc.State()
+			load := st.StreamsActive + st.StreamsReserved + st.StreamsPending
+			if st.MaxConcurrentStreams == 0 || load < int(st.MaxConcurrentStreams) {
+				p.mu.Unlock()
+				return cc, nil
+			}
+			if leastLoaded == nil || load < leastLoad {
+				leastLoaded, leastLoad = cc, load
+			}
+		}
+		if p.max > 0 && len(live)+p.dialing[addr] >= p.max {
+			if leastLoaded != nil {
+				// every connection is at its stream limit; the round trip waits for a free stream
+				p.mu.Unlock()
+				return leastLoaded, nil
+			}
+			// the other slots are dials in flight, wait for one of them
+			done, ok := p.dialed[addr]
+			if !ok {
+				done = make(chan struct{})
+				p.dialed[addr] = done
+			}
+			p.mu.Unlock()
+			select {
+			case <-done:
+				continue
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
+
+		// the slot is reserved while dialing so a slow dial or handshake blocks
+		// neither reads on live connections nor dials to other addresses
+		p.dialing[addr]++
+		p.mu.Unlock()
+		cc, err := p.dial(req.Context(), addr)
+		p.mu.Lock()
+		p.dialing[addr]--
+		if err == nil {
+			p.conns[addr] = append(p.conns[addr], cc)
+		}
+		if done, ok := p.dialed[addr]; ok {
+			close(done)
+			delete(p.dialed, addr)
+		}
+		p.mu.Unlock()
+		return cc, err
+	}
+}
+
+func (p *connPool) MarkDead(dead *http2.ClientConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for addr, conns := range p.conns {
+		for i, cc := range conns {
+			if cc == dead {
+				p.conns[addr] = append(conns[:i:i], conns[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (p *connPool) dial(ctx context.Context, addr string) (*http2.ClientConn, error) {
+	cfg := p.tls.Clone()
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ServerName = host
+	}
+	// addr is the authority of the request, the target decides where to connect
+	raw, err := p.target.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(raw, cfg)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	if proto := conn.ConnectionState().NegotiatedProtocol; proto != http2.NextProtoTLS {
+		conn.Close()
+		// without h2 the server would see HTTP/1.1 framing, gRPC needs HTTP/2
+		return nil, fmt.Errorf("server at %s did not negotiate %q with ALPN (got %q), gRPC requires HTTP/2", p.target.raw, http2.NextProtoTLS, proto)
+	}
+	return p.t.NewClientConn(conn)
+}
+
+// urlAddr is the host:port the transport dials for rawURL
+func urlAddr(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	return net.JoinHostPort(u.Hostname(), "443"), nil
+}
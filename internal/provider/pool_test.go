@@ -0,0 +1,229 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	echo "github.com/salrashid123/grpc_wireformat/grpc_services/src/echo"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTransportPool(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(strings.Replace(caCert, `\n`, "\n", -1)))
+	tlsConfig := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+
+	in, err := proto.Marshal(&echo.EchoRequest{FirstName: "sal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "https://" + testHttpMock.Address + "/echo.EchoServer/SayHello"
+	key := transportKey{Addr: testHttpMock.Address, SNI: "localhost", CA: caCert}
+	target, err := parseTarget(testHttpMock.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := defaultPoolSettings
+	settings.MaxConnections = 1
+	pool := newTransportPool(settings)
+
+	call := func(k transportKey) error {
+		client := &http.Client{Transport: pool.transport(k, target, tlsConfig)}
+		_, err := doCall(context.Background(), client, url, "", nil, in, nil, messageLimits{})
+		return err
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := call(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := atomic.LoadInt32(&testHttpMock.listener.accepted); got != 1 {
+		t.Errorf("sequential calls opened %d connections, want 1", got)
+	}
+
+	// more concurrent calls than the server allows streams, queued on the one connection
+	var wg sync.WaitGroup
+	errs := make(chan error, 25)
+	for i := 0; i < 25; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- call(key)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := atomic.LoadInt32(&testHttpMock.listener.accepted); got != 1 {
+		t.Errorf("max_connections = 1 opened %d connections", got)
+	}
+
+	// different TLS settings never share a connection
+	other := key
+	other.InsecureSkipVerify = true
+	if err := call(other); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&testHttpMock.listener.accepted); got != 2 {
+		t.Errorf("got %d connections, want a second one for other TLS settings", got)
+	}
+}
+
+func TestTransportPoolSessionCache(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	in, err := proto.Marshal(&echo.EchoRequest{FirstName: "sal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "https://" + testHttpMock.Address + "/echo.EchoServer/SayHello"
+	target, err := parseTarget(testHttpMock.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := newTransportPool(defaultPoolSettings)
+	call := func(k transportKey, tlsConfig *tls.Config) error {
+		client := &http.Client{Transport: pool.transport(k, target, tlsConfig)}
+		_, err := doCall(context.Background(), client, url, "", nil, in, nil, messageLimits{})
+		return err
+	}
+
+	// go only checks VerifyPeerCertificate, which spiffe uses, on a full
+	// handshake; a session from insecure_skip_verify must not let it be skipped
+	if err := call(transportKey{Addr: testHttpMock.Address, SNI: "localhost", InsecureSkipVerify: true}, &tls.Config{InsecureSkipVerify: true, ServerName: "localhost"}); err != nil {
+		t.Fatal(err)
+	}
+	strict := &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         "localhost",
+		VerifyPeerCertificate: func([][]byte, [][]*x509.Certificate) error {
+			return errors.New("not the expected workload")
+		},
+	}
+	err = call(transportKey{Addr: testHttpMock.Address, SNI: "localhost", SPIFFE: "spiffe://example.org/echo"}, strict)
+	if err == nil || !strings.Contains(err.Error(), "not the expected workload") {
+		t.Errorf("got error %v, want the peer certificate checked instead of a resumed session", err)
+	}
+}
+
+func TestConnPoolSlowDial(t *testing.T) {
+	testHttpMock, err := setUpMockGRPCServer([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testHttpMock.server.GracefulStop()
+
+	// forwards the first connection to the server and blackholes the others
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		var held []net.Conn
+		defer func() {
+			for _, conn := range held {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			if len(held) > 0 {
+				held = append(held, conn)
+				continue
+			}
+			held = append(held, conn)
+			upstream, err := net.Dial("tcp", testHttpMock.Address)
+			if err != nil {
+				continue
+			}
+			go pipe(conn, upstream, conn)
+		}
+	}()
+
+	in, err := proto.Marshal(&echo.EchoRequest{FirstName: "sal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := parseTarget(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(strings.Replace(caCert, `\n`, "\n", -1)))
+	pool := newTransportPool(defaultPoolSettings)
+	client := &http.Client{Transport: pool.transport(transportKey{Addr: l.Addr().String()}, target, &tls.Config{RootCAs: roots, ServerName: "localhost"})}
+	call := func(ctx context.Context, host string) error {
+		_, err := doCall(ctx, client, "https://"+host+"/echo.EchoServer/SayHello", "", nil, in, nil, messageLimits{})
+		return err
+	}
+
+	if err := call(context.Background(), "first.internal"); err != nil {
+		t.Fatal(err)
+	}
+	// a dial for another address hangs in the handshake
+	ctx, cancel := context.WithCancel(context.Background())
+	hung := make(chan error, 1)
+	go func() { hung <- call(ctx, "second.internal") }()
+	time.Sleep(100 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() { done <- call(context.Background(), "first.internal") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("call on the live connection: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("a call on a live connection waited for a dial to another address")
+	}
+	cancel()
+	if err := <-hung; err == nil {
+		t.Error("the blackholed dial succeeded")
+	}
+}
+
+func TestURLAddr(t *testing.T) {
+	tests := map[string]string{
+		"https://localhost:50051/echo.EchoServer/SayHello":  "localhost:50051",
+		"https://grpc.example.com/echo.EchoServer/SayHello": "grpc.example.com:443",
+		"https://[::1]/echo.EchoServer/SayHello":            "[::1]:443",
+	}
+	for u, want := range tests {
+		got, err := urlAddr(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("urlAddr(%q) = %q, want %q", u, got, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"buf.build/go/protovalidate"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	validatorOnce sync.Once
+	validator     protovalidate.Validator
+	validatorErr  error
+)
+
+// getValidator returns the shared protovalidate validator; it caches the
+// compiled rules per message descriptor so it is built once per provider process
+func getValidator() (protovalidate.Validator, error) {
+	validatorOnce.Do(func() {
+		validator, validatorErr = protovalidate.New()
+	})
+	return validator, validatorErr
+}
+
+// validateMessage evaluates the buf.validate rules found in the field and
+// message options of m's descriptor and returns one diagnostic per violation
+func validateMessage(m proto.Message, summary string, path cty.Path) diag.Diagnostics {
+	v, err := getValidator()
+	if err != nil {
+		return diag.Errorf("Error creating protovalidate validator: %s", err)
+	}
+
+	err = v.Validate(m)
+	if err == nil {
+		return nil
+	}
+
+	var valErr *protovalidate.ValidationError
+	if !errors.As(err, &valErr) {
+		// the rules themselves could not be compiled or evaluated
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       fmt.Sprintf("Error evaluating buf.validate rules of %s", m.ProtoReflect().Descriptor().FullName()),
+			Detail:        err.Error(),
+			AttributePath: path,
+		}}
+	}
+
+	var diags diag.Diagnostics
+	for _, violation := range valErr.Violations {
+		detail := fmt.Sprintf("%s [%s]", violation.Proto.GetMessage(), violation.Proto.GetRuleId())
+		if fieldPath := protovalidate.FieldPathString(violation.Proto.GetField()); fieldPath != "" {
+			detail = fieldPath + ": " + detail
+		}
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       summary,
+			Detail:        detail,
+			AttributePath: path,
+		})
+	}
+	return diags
+}
@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	"github.com/hashicorp/go-cty/cty"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// validatedEchoDescriptor is the echo.proto wire format with buf.validate rules:
+// first_name needs at least 5 characters and the reply message at most 5
+func validatedEchoDescriptor(t *testing.T) *descriptorpb.FileDescriptorProto {
+	t.Helper()
+	minLen := &descriptorpb.FieldOptions{}
+	proto.SetExtension(minLen, validate.E_Field, &validate.FieldRules{
+		Type: &validate.FieldRules_String_{String_: &validate.StringRules{MinLen: proto.Uint64(5)}},
+	})
+	maxLen := &descriptorpb.FieldOptions{}
+	proto.SetExtension(maxLen, validate.E_Field, &validate.FieldRules{
+		Type: &validate.FieldRules_String_{String_: &validate.StringRules{MaxLen: proto.Uint64(5)}},
+	})
+	stringField := func(name string, number int32, opts *descriptorpb.FieldOptions) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			JsonName: proto.String(name),
+			Options:  opts,
+		}
+	}
+	return &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("vecho/vecho.proto"),
+		Package:    proto.String("vecho"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"buf/validate/validate.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("EchoRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					stringField("first_name", 1, minLen),
+					stringField("last_name", 2, nil),
+				},
+			},
+			{
+				Name:  proto.String("EchoReply"),
+				Field: []*descriptorpb.FieldDescriptorProto{stringField("message", 1, maxLen)},
+			},
+		},
+	}
+}
+
+func TestValidateMessage(t *testing.T) {
+	// round trip through bytes so the rules are read the way registry_files are
+	b, err := proto.Marshal(validatedEchoDescriptor(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fdp := &descriptorpb.FileDescriptorProto{}
+	if err := proto.Unmarshal(b, fdp); err != nil {
+		t.Fatal(err)
+	}
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := fd.Messages().ByName("EchoRequest")
+	path := cty.GetAttrPath("request_body")
+
+	m := dynamicpb.NewMessage(md)
+	m.Set(md.Fields().ByName("first_name"), protoreflect.ValueOfString("salamander"))
+	if diags := validateMessage(m, "Request violates buf.validate rules", path); diags.HasError() {
+		t.Errorf("unexpected violations: %v", diags)
+	}
+
+	m.Set(md.Fields().ByName("first_name"), protoreflect.ValueOfString("sal"))
+	diags := validateMessage(m, "Request violates buf.validate rules", path)
+	if len(diags) != 1 {
+		t.Fatalf("expected one violation, got %v", diags)
+	}
+	if !strings.HasPrefix(diags[0].Detail, "first_name: value length must be at least 5 characters [string.min_len]") {
+		t.Errorf("unexpected detail %q", diags[0].Detail)
+	}
+	if !diags[0].AttributePath.Equals(path) {
+		t.Errorf("unexpected attribute path %v", diags[0].AttributePath)
+	}
+}
@@ -1,15 +1,307 @@
 package provider
 
 import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 func New() *schema.Provider {
 	return &schema.Provider{
-		Schema: map[string]*schema.Schema{},
+		Schema: withTLSSchema(map[string]*schema.Schema{
+			"base_url": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GRPC_FULL_BASE_URL", ""),
+				Description: "Scheme and authority, eg https://localhost:50051, prepended to relative data source urls.",
+			},
+			"ca": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: caDefaultFunc,
+				Description: "Default PEM encoded CA for data sources that do not set one. Falls back to GRPC_FULL_CA or the file named by GRPC_FULL_CA_FILE.",
+			},
+			"sni": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GRPC_FULL_SNI", ""),
+				Description: "Default TLS server name for data sources that do not set one.",
+			},
+			"request_headers": {
+				Type:     schema.TypeMap,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Description: "Headers sent with every call; data source request_headers are merged over these key by key.",
+			},
+			"request_timeout_ms": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GRPC_FULL_REQUEST_TIMEOUT_MS", 0),
+				Description: "Default timeout for data sources that do not set one.",
+			},
+			"insecure_skip_verify": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GRPC_FULL_INSECURE_SKIP_VERIFY", false),
+				Description: "Skip server TLS verification for every data source.",
+			},
+			"pinned_spki_sha256":        pinsSchema(),
+			"resolve":                   resolveSchema(),
+			"proxy":                     proxySchema(),
+			"proxy_ca":                  proxyCASchema(),
+			"transport_engine":          transportEngineSchema(),
+			"max_receive_message_bytes": messageSizeSchema("Largest response message accepted, default no limit."),
+			"max_send_message_bytes":    messageSizeSchema("Largest request message sent, 0 for no limit."),
+			"registry_files": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:             schema.TypeString,
+					ValidateDiagFunc: validateRegistryFile,
+				},
+				Description: "Descriptor sets loaded once for all data sources, in addition to their own registry_files.",
+			},
+			"max_concurrent_calls": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      0,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Calls in flight across all data sources, 0 for no limit.",
+			},
+			"rate_limit": {
+				Type:         schema.TypeFloat,
+				Optional:     true,
+				Default:      0,
+				ValidateFunc: validation.FloatAtLeast(0),
+				Description:  "Calls per second across all data sources, 0 for no limit.",
+			},
+			"rate_limit_burst": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      1,
+				ValidateFunc: validation.IntAtLeast(1),
+				Description:  "Calls that may be sent at once before rate_limit applies.",
+			},
+			"endpoint": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        endpointSchema(),
+				Description: "Named connection profiles data sources select with endpoint and method.",
+			},
+			"credentials": credentialsSchema(),
+			"spiffe":      spiffeSchema(),
+			"signing":     signingSchema(),
+			"ssh_tunnel":  sshTunnelSchema(),
+			"connection_pool": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Elem:        connectionPoolSchema(),
+				Description: "How connections are shared between data source reads.",
+			},
+		}),
 		DataSourcesMap: map[string]*schema.Resource{
 			"grpc": dataSource(),
 		},
-		ResourcesMap: map[string]*schema.Resource{},
+		ResourcesMap:         map[string]*schema.Resource{},
+		ConfigureContextFunc: providerConfigure,
+	}
+}
+
+// providerConfig holds the provider block settings every data source read starts from
+type providerConfig struct {
+	BaseURL            string
+	CA                 string
+	SNI                string
+	RequestHeaders     map[string]string
+	RequestTimeoutMS   int
+	InsecureSkipVerify bool
+	PinnedSPKISHA256   []string
+	TLS                tlsSettings
+	Resolve            map[string]string
+	Proxy              string
+	ProxyCA            string
+	TransportEngine    string
+	MessageLimits      messageLimits
+	Endpoints          map[string]*endpointConfig
+	Pool               *transportPool
+	MaxConcurrentCalls int
+	RateLimit          float64
+	RateLimitBurst     int
+	Limiter            *callLimiter
+	Tokens             *tokenCache
+	Credentials        credentialSource
+	SPIFFE             *spiffeConfig
+	SPIFFESources      *spiffeSources
+	Signer             requestSigner
+	SSHTunnel          *sshTunnelConfig
+	SSHClients         *sshClients
+	Balancer           *targetBalancer
+}
+
+func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
+	config := &providerConfig{
+		BaseURL:            d.Get("base_url").(string),
+		CA:                 d.Get("ca").(string),
+		SNI:                d.Get("sni").(string),
+		RequestHeaders:     map[string]string{},
+		RequestTimeoutMS:   d.Get("request_timeout_ms").(int),
+		InsecureSkipVerify: d.Get("insecure_skip_verify").(bool),
+		TLS:                tlsSettings{}.overlay(configGetter(d, "")),
+		Resolve:            mergeResolve(nil, d.Get("resolve").(map[string]interface{})),
+		Proxy:              d.Get("proxy").(string),
+		ProxyCA:            d.Get("proxy_ca").(string),
+		TransportEngine:    d.Get("transport_engine").(string),
+		MessageLimits:      messageLimits{}.overlay(configGetter(d, "")),
+		Pool:               newTransportPool(parsePoolSettings(d)),
+		MaxConcurrentCalls: d.Get("max_concurrent_calls").(int),
+		RateLimit:          d.Get("rate_limit").(float64),
+		RateLimitBurst:     d.Get("rate_limit_burst").(int),
+		Tokens:             newTokenCache(),
+		SPIFFE:             parseSPIFFE(d.Get("spiffe").([]interface{})),
+		SPIFFESources:      newSPIFFESources(),
+		SSHClients:         newSSHClients(),
+		Balancer:           newTargetBalancer(),
+	}
+	// one limiter shared by every read that does not use an endpoint with its own limits
+	config.Limiter = newCallLimiter(config.MaxConcurrentCalls, config.RateLimit, config.RateLimitBurst)
+
+	if config.BaseURL != "" {
+		u, err := url.Parse(config.BaseURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, diag.Errorf("Error base_url %q must be an absolute url like https://localhost:50051", config.BaseURL)
+		}
+	}
+
+	for name, value := range d.Get("request_headers").(map[string]interface{}) {
+		config.RequestHeaders[name] = value.(string)
+	}
+
+	pins, err := parsePins(d.Get("pinned_spki_sha256").([]interface{}))
+	if err != nil {
+		return nil, diag.Errorf("Error pinned_spki_sha256: %s", err)
+	}
+	config.PinnedSPKISHA256 = pins
+
+	creds, err := parseCredentials(d.Get("credentials").([]interface{}), config.Tokens)
+	if err != nil {
+		return nil, diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid credentials",
+			Detail:        err.Error(),
+			AttributePath: cty.GetAttrPath("credentials"),
+		}}
+	}
+	config.Credentials = creds
+
+	signer, err := parseSigning(d.Get("signing").([]interface{}))
+	if err != nil {
+		return nil, diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid signing",
+			Detail:        err.Error(),
+			AttributePath: cty.GetAttrPath("signing"),
+		}}
+	}
+	config.Signer = signer
+
+	tunnel, err := parseSSHTunnel(d.Get("ssh_tunnel").([]interface{}))
+	if err != nil {
+		return nil, diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid ssh_tunnel",
+			Detail:        err.Error(),
+			AttributePath: cty.GetAttrPath("ssh_tunnel"),
+		}}
+	}
+	config.SSHTunnel = tunnel
+
+	// provider level descriptors are registered once and shared by all reads
+	diags := registerFiles(cty.GetAttrPath("registry_files"), d.Get("registry_files").([]interface{}))
+	if diags.HasError() {
+		return nil, diags
+	}
+
+	endpoints, endpointDiags := parseEndpoints(d, config)
+	diags = append(diags, endpointDiags...)
+	if diags.HasError() {
+		return nil, diags
+	}
+	config.Endpoints = endpoints
+
+	return config, diags
+}
+
+// defaultEndpoint is the connection used by data sources that set a url instead of an endpoint
+func (c *providerConfig) defaultEndpoint() *endpointConfig {
+	return &endpointConfig{
+		CA:                 c.CA,
+		SNI:                c.SNI,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		PinnedSPKISHA256:   c.PinnedSPKISHA256,
+		TLS:                c.TLS,
+		Resolve:            c.Resolve,
+		Proxy:              c.Proxy,
+		ProxyCA:            c.ProxyCA,
+		TransportEngine:    c.TransportEngine,
+		MessageLimits:      c.MessageLimits,
+		RequestTimeoutMS:   c.RequestTimeoutMS,
+		RequestHeaders:     c.RequestHeaders,
+		Limiter:            c.Limiter,
+		Credentials:        c.Credentials,
+		SPIFFE:             c.SPIFFE,
+		Signer:             c.Signer,
+		SSHTunnel:          c.SSHTunnel,
+	}
+}
+
+// caDefaultFunc reads the default CA from GRPC_FULL_CA or the file named by GRPC_FULL_CA_FILE
+func caDefaultFunc() (interface{}, error) {
+	if v := os.Getenv("GRPC_FULL_CA"); v != "" {
+		return v, nil
+	}
+	if f := os.Getenv("GRPC_FULL_CA_FILE"); f != "" {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading GRPC_FULL_CA_FILE: %v", err)
+		}
+		return string(b), nil
+	}
+	return "", nil
+}
+
+// mergeHeaders returns the provider headers overlaid key by key with the data source headers
+func mergeHeaders(defaults map[string]string, headers map[string]interface{}) map[string]string {
+	merged := make(map[string]string, len(defaults)+len(headers))
+	for name, value := range defaults {
+		merged[strings.ToLower(name)] = value
+	}
+	for name, value := range headers {
+		merged[strings.ToLower(name)] = value.(string)
+	}
+	return merged
+}
+
+// resolveURL joins a relative data source url onto base_url
+func resolveURL(base string, u string) (string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	if parsed.IsAbs() {
+		return u, nil
+	}
+	if base == "" {
+		return "", fmt.Errorf("url %q is relative and the provider has no base_url", u)
 	}
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(u, "/"), nil
 }
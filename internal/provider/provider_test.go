@@ -15,3 +15,46 @@ func TestProvider(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 }
+
+func TestMergeHeaders(t *testing.T) {
+	got := mergeHeaders(
+		map[string]string{"Authorization": "bearer provider", "x-env": "prod"},
+		map[string]interface{}{"authorization": "bearer data", "x-request": "1"},
+	)
+	want := map[string]string{"authorization": "bearer data", "x-env": "prod", "x-request": "1"}
+	if len(got) != len(want) {
+		t.Fatalf("mergeHeaders() = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("mergeHeaders()[%q] = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestResolveURL(t *testing.T) {
+	tests := []struct {
+		base string
+		url  string
+		want string
+	}{
+		{"", "https://localhost:50051/echo.EchoServer/SayHello", "https://localhost:50051/echo.EchoServer/SayHello"},
+		{"https://other:443", "https://localhost:50051/echo.EchoServer/SayHello", "https://localhost:50051/echo.EchoServer/SayHello"},
+		{"https://localhost:50051", "/echo.EchoServer/SayHello", "https://localhost:50051/echo.EchoServer/SayHello"},
+		{"https://localhost:50051/", "echo.EchoServer/SayHello", "https://localhost:50051/echo.EchoServer/SayHello"},
+		{"https://gateway/prefix", "/echo.EchoServer/SayHello", "https://gateway/prefix/echo.EchoServer/SayHello"},
+	}
+	for _, tc := range tests {
+		got, err := resolveURL(tc.base, tc.url)
+		if err != nil {
+			t.Fatalf("resolveURL(%q, %q): %v", tc.base, tc.url, err)
+		}
+		if got != tc.want {
+			t.Errorf("resolveURL(%q, %q) = %q, want %q", tc.base, tc.url, got, tc.want)
+		}
+	}
+
+	if _, err := resolveURL("", "/echo.EchoServer/SayHello"); err == nil {
+		t.Error("expected an error for a relative url without base_url")
+	}
+}
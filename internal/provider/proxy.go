@@ -0,0 +1,195 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// proxySchema is the proxy attribute of the provider, an endpoint or a data source
+func proxySchema() *schema.Schema {
+	return &schema.Schema{
+		Type:             schema.TypeString,
+		Optional:         true,
+		Sensitive:        true,
+		ValidateDiagFunc: validateProxy,
+		Description:      "http://, https:// or socks5:// proxy url, default HTTPS_PROXY and NO_PROXY.",
+	}
+}
+
+// proxyCASchema is the proxy_ca attribute of the provider, an endpoint or a data source
+func proxyCASchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeString,
+		Optional:    true,
+		Description: "PEM encoded CA certificates trusted for an https:// proxy instead of the system roots.",
+	}
+}
+
+// parseProxy checks the proxy url is http, https or socks5 with a host
+func parseProxy(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("proxy is not a url: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy %s must be an http://, https://, socks5:// or socks5h:// url", u.Redacted())
+	}
+	if u.Hostname() == "" || (u.Path != "" && u.Path != "/") {
+		return nil, fmt.Errorf("proxy %s must be scheme://[user:password@]host[:port]", u.Redacted())
+	}
+	return u, nil
+}
+
+func validateProxy(v interface{}, path cty.Path) diag.Diagnostics {
+	raw, ok := v.(string)
+	if !ok || raw == "" {
+		return nil
+	}
+	if _, err := parseProxy(raw); err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid proxy",
+			Detail:        err.Error(),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
+
+// proxyFor is the proxy to reach addr through: the configured one, else the
+// one from HTTPS_PROXY unless NO_PROXY matches, or nil to connect directly
+func proxyFor(configured *url.URL, addr string) (*url.URL, error) {
+	if configured != nil {
+		return configured, nil
+	}
+	u, err := httpproxy.FromEnvironment().ProxyFunc()(&url.URL{Scheme: "https", Host: addr})
+	if err != nil || u == nil {
+		return nil, err
+	}
+	return parseProxy(u.String())
+}
+
+// proxyTLSConfig is the TLS config for an https proxy, trusting ca when set
+func proxyTLSConfig(ca string) (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if ca != "" {
+		roots, err := loadRoots(ca, nil, false)
+		if err != nil {
+			return nil, fmt.Errorf("proxy_%v", err)
+		}
+		cfg.RootCAs = roots
+	}
+	return cfg, nil
+}
+
+// dialProxy connects to addr through the proxy p, an https proxy is verified against proxyCA
+func dialProxy(ctx context.Context, p *url.URL, addr string, proxyCA string) (net.Conn, error) {
+	if p.Scheme == "socks5" || p.Scheme == "socks5h" {
+		// the hostname is sent to the proxy, which resolves it
+		d, err := proxy.FromURL(p, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := d.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("socks5 proxy %s: %v", p.Redacted(), err)
+		}
+		return conn, nil
+	}
+	return dialConnect(ctx, p, addr, proxyCA)
+}
+
+// dialConnect opens an HTTP CONNECT tunnel to addr, over TLS for an https proxy
+func dialConnect(ctx context.Context, p *url.URL, addr string, proxyCA string) (net.Conn, error) {
+	proxyAddr := p.Host
+	if p.Port() == "" {
+		port := "80"
+		if p.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(p.Hostname(), port)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %v", p.Redacted(), err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(30 * time.Second))
+	}
+
+	if p.Scheme == "https" {
+		cfg, err := proxyTLSConfig(proxyCA)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		cfg.ServerName = p.Hostname()
+		tc := tls.Client(conn, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy %s: %v", p.Redacted(), err)
+		}
+		conn = tc
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if p.User != nil {
+		password, _ := p.User.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(p.User.Username()+":"+password)))
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %v", p.Redacted(), err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %v", p.Redacted(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// the tunnel starts right after a 200, only a refusal has a body to drain
+		resp.Body.Close()
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused CONNECT to %s: %s", p.Redacted(), addr, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	if br.Buffered() > 0 {
+		// the server spoke first, keep what was read along with the response
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads the bytes buffered while reading the CONNECT response first
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -0,0 +1,520 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// rawField is one field of a message decoded without a descriptor, the way
+// `protoc --decode_raw` does.
+//
+// Value holds a uint64 for varint, fixed32 and fixed64 fields, a string for
+// printable length delimited fields, a rawMessage for length delimited fields
+// that parse as a message and for groups, or []byte for anything else.
+type rawField struct {
+	Number protowire.Number
+	Type   protowire.Type
+	Value  interface{}
+}
+
+type rawMessage []rawField
+
+// decodeRawMessage parses b as protobuf wire format without a schema
+func decodeRawMessage(b []byte) (rawMessage, error) {
+	m, n, err := decodeRawFields(b, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(b) {
+		return nil, fmt.Errorf("unexpected end group at offset %d", n)
+	}
+	return m, nil
+}
+
+// decodeRawFields reads fields until b is exhausted or the end of group
+// endGroup is found; it returns the number of bytes consumed
+func decodeRawFields(b []byte, endGroup protowire.Number) (rawMessage, int, error) {
+	m := rawMessage{}
+	pos := 0
+	for pos < len(b) {
+		num, typ, n := protowire.ConsumeTag(b[pos:])
+		if n < 0 {
+			return nil, pos, fmt.Errorf("invalid tag at offset %d: %v", pos, protowire.ParseError(n))
+		}
+		pos += n
+		f := rawField{Number: num, Type: typ}
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b[pos:])
+			if n < 0 {
+				return nil, pos, fmt.Errorf("invalid varint for field %d: %v", num, protowire.ParseError(n))
+			}
+			f.Value = v
+			pos += n
+		case protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(b[pos:])
+			if n < 0 {
+				return nil, pos, fmt.Errorf("invalid fixed32 for field %d: %v", num, protowire.ParseError(n))
+			}
+			f.Value = uint64(v)
+			pos += n
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b[pos:])
+			if n < 0 {
+				return nil, pos, fmt.Errorf("invalid fixed64 for field %d: %v", num, protowire.ParseError(n))
+			}
+			f.Value = v
+			pos += n
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b[pos:])
+			if n < 0 {
+				return nil, pos, fmt.Errorf("invalid length delimited field %d: %v", num, protowire.ParseError(n))
+			}
+			f.Value = guessRawBytes(v)
+			pos += n
+		case protowire.StartGroupType:
+			g, n, err := decodeRawFields(b[pos:], num)
+			if err != nil {
+				return nil, pos, err
+			}
+			f.Value = g
+			pos += n
+		case protowire.EndGroupType:
+			if num != endGroup {
+				return nil, pos, fmt.Errorf("unexpected end group for field %d", num)
+			}
+			return m, pos, nil
+		default:
+			return nil, pos, fmt.Errorf("unknown wire type %d for field %d", typ, num)
+		}
+		m = append(m, f)
+	}
+	if endGroup != 0 {
+		return nil, pos, fmt.Errorf("missing end group for field %d", endGroup)
+	}
+	return m, pos, nil
+}
+
+// guessRawBytes decides how to show a length delimited value: printable
+// text stays a string, bytes that parse as a message become a nested message
+// and anything else is kept as bytes
+func guessRawBytes(v []byte) interface{} {
+	if isPrintable(v) {
+		return string(v)
+	}
+	if len(v) > 0 {
+		if nested, err := decodeRawMessage(v); err == nil {
+			return nested
+		}
+	}
+	return append([]byte(nil), v...)
+}
+
+func isPrintable(v []byte) bool {
+	if !utf8.Valid(v) {
+		return false
+	}
+	for _, r := range string(v) {
+		if !unicode.IsPrint(r) && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalJSON writes the message as an object keyed by field number, in field
+// number order; repeated field numbers become arrays
+func (m rawMessage) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, num := range m.numbers() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, "%q:", strconv.Itoa(int(num)))
+		values := m.values(num)
+		if len(values) > 1 {
+			buf.WriteByte('[')
+		}
+		for j, f := range values {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			b, err := f.jsonValue()
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(b)
+		}
+		if len(values) > 1 {
+			buf.WriteByte(']')
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (f rawField) jsonValue() ([]byte, error) {
+	switch v := f.Value.(type) {
+	case uint64:
+		return []byte(strconv.FormatUint(v, 10)), nil
+	case []byte:
+		return json.Marshal(base64.StdEncoding.EncodeToString(v))
+	default:
+		return json.Marshal(v)
+	}
+}
+
+func (m rawMessage) numbers() []protowire.Number {
+	var nums []protowire.Number
+	seen := map[protowire.Number]bool{}
+	for _, f := range m {
+		if !seen[f.Number] {
+			seen[f.Number] = true
+			nums = append(nums, f.Number)
+		}
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+	return nums
+}
+
+func (m rawMessage) values(num protowire.Number) []rawField {
+	var fields []rawField
+	for _, f := range m {
+		if f.Number == num {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// text renders the message like `protoc --decode_raw`, in wire order
+func (m rawMessage) text() string {
+	var buf bytes.Buffer
+	m.writeText(&buf, "")
+	return buf.String()
+}
+
+func (m rawMessage) writeText(buf *bytes.Buffer, indent string) {
+	for _, f := range m {
+		switch v := f.Value.(type) {
+		case rawMessage:
+			fmt.Fprintf(buf, "%s%d {\n", indent, f.Number)
+			v.writeText(buf, indent+"  ")
+			fmt.Fprintf(buf, "%s}\n", indent)
+		case uint64:
+			switch f.Type {
+			case protowire.Fixed32Type:
+				fmt.Fprintf(buf, "%s%d: 0x%08x\n", indent, f.Number, v)
+			case protowire.Fixed64Type:
+				fmt.Fprintf(buf, "%s%d: 0x%016x\n", indent, f.Number, v)
+			default:
+				fmt.Fprintf(buf, "%s%d: %d\n", indent, f.Number, v)
+			}
+		case string:
+			fmt.Fprintf(buf, "%s%d: %s\n", indent, f.Number, strconv.Quote(v))
+		case []byte:
+			fmt.Fprintf(buf, "%s%d: %s\n", indent, f.Number, strconv.Quote(string(v)))
+		}
+	}
+}
+
+// encodeRawJSON builds wire bytes from a json object keyed by field number.
+//
+// Keys are either "N" or "N:type".  Without a type integers are written as
+// varints, other numbers as doubles, bools as varints, strings as length
+// delimited, objects as nested messages and arrays as repeated fields.  The
+// type suffix is one of int, uint, sint, bool, fixed32, sfixed32, float,
+// fixed64, sfixed64, double, string, bytes (base64) or message.
+func encodeRawJSON(body string) ([]byte, error) {
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("raw request must be a json object keyed by field number")
+	}
+	return appendRawObject(nil, obj, "$")
+}
+
+func appendRawObject(b []byte, obj map[string]interface{}, path string) ([]byte, error) {
+	type key struct {
+		num   protowire.Number
+		typ   string
+		label string
+	}
+	keys := make([]key, 0, len(obj))
+	for k := range obj {
+		numStr, typ := k, ""
+		if i := strings.Index(k, ":"); i >= 0 {
+			numStr, typ = k[:i], k[i+1:]
+		}
+		num, err := strconv.ParseInt(numStr, 10, 32)
+		if err != nil || !protowire.Number(num).IsValid() {
+			return nil, fmt.Errorf("%s: %q is not a valid field number", path, k)
+		}
+		keys = append(keys, key{protowire.Number(num), typ, k})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].num < keys[j].num })
+
+	var err error
+	for _, k := range keys {
+		fieldPath := path + "." + k.label
+		v := obj[k.label]
+		if l, ok := v.([]interface{}); ok {
+			for i, e := range l {
+				b, err = appendRawValue(b, k.num, k.typ, e, fmt.Sprintf("%s[%d]", fieldPath, i))
+				if err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		b, err = appendRawValue(b, k.num, k.typ, v, fieldPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func appendRawValue(b []byte, num protowire.Number, typ string, v interface{}, path string) ([]byte, error) {
+	if v == nil {
+		return b, nil
+	}
+	if typ == "" {
+		switch t := v.(type) {
+		case json.Number:
+			typ = "double"
+			if _, err := strconv.ParseInt(t.String(), 10, 64); err == nil {
+				typ = "int"
+			} else if _, err := strconv.ParseUint(t.String(), 10, 64); err == nil {
+				typ = "uint"
+			}
+		case bool:
+			typ = "bool"
+		case string:
+			typ = "string"
+		case map[string]interface{}:
+			typ = "message"
+		default:
+			return nil, fmt.Errorf("%s: unsupported value %v", path, v)
+		}
+	}
+
+	switch typ {
+	case "int", "uint", "sint", "fixed32", "sfixed32", "fixed64", "sfixed64", "float", "double":
+		n, ok := v.(json.Number)
+		if !ok {
+			if s, isString := v.(string); isString {
+				n, ok = json.Number(s), true
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s: %s expects a number", path, typ)
+		}
+		return appendRawNumber(b, num, typ, n, path)
+	case "bool":
+		bv, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s: bool expects true or false", path)
+		}
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(bv)), nil
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: string expects a json string", path)
+		}
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendString(b, s), nil
+	case "bytes":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: bytes expects a base64 string", path)
+		}
+		raw, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, raw), nil
+	case "message":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: message expects a json object", path)
+		}
+		nested, err := appendRawObject(nil, obj, path)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, nested), nil
+	}
+	return nil, fmt.Errorf("%s: unknown wire type %q", path, typ)
+}
+
+func appendRawNumber(b []byte, num protowire.Number, typ string, n json.Number, path string) ([]byte, error) {
+	s := n.String()
+	switch typ {
+	case "int":
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(i)), nil
+	case "uint":
+		u, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, u), nil
+	case "sint":
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeZigZag(i)), nil
+	case "fixed32", "sfixed32":
+		var u uint64
+		if typ == "fixed32" {
+			v, err := strconv.ParseUint(s, 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			u = v
+		} else {
+			v, err := strconv.ParseInt(s, 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			u = uint64(uint32(int32(v)))
+		}
+		b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+		return protowire.AppendFixed32(b, uint32(u)), nil
+	case "fixed64", "sfixed64":
+		var u uint64
+		if typ == "fixed64" {
+			v, err := strconv.ParseUint(s, 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			u = v
+		} else {
+			v, err := strconv.ParseInt(s, 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			u = uint64(v)
+		}
+		b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, u), nil
+	case "float":
+		f, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+		return protowire.AppendFixed32(b, math.Float32bits(float32(f))), nil
+	default:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(f)), nil
+	}
+}
+
+var wireTypeNames = map[protowire.Type]string{
+	protowire.VarintType:     "varint",
+	protowire.Fixed32Type:    "fixed32",
+	protowire.Fixed64Type:    "fixed64",
+	protowire.BytesType:      "bytes",
+	protowire.StartGroupType: "group",
+}
+
+// unknownField is a field found on the wire that the message descriptor does not define
+type unknownField struct {
+	Path     string
+	Number   protowire.Number
+	WireType string
+	Value    string
+}
+
+// collectUnknownFields walks m and every message nested in it and returns
+// the fields that were kept as unknown while unmarshalling
+func collectUnknownFields(m protoreflect.Message) ([]unknownField, error) {
+	var out []unknownField
+	err := appendUnknownFields(&out, m, "")
+	return out, err
+}
+
+func appendUnknownFields(out *[]unknownField, m protoreflect.Message, path string) error {
+	if raw := m.GetUnknown(); len(raw) > 0 {
+		rm, err := decodeRawMessage(raw)
+		if err != nil {
+			return fmt.Errorf("unknown fields of %s: %v", m.Descriptor().FullName(), err)
+		}
+		for _, f := range rm {
+			v, err := f.jsonValue()
+			if err != nil {
+				return err
+			}
+			*out = append(*out, unknownField{
+				Path:     path,
+				Number:   f.Number,
+				WireType: wireTypeNames[f.Type],
+				Value:    string(v),
+			})
+		}
+	}
+
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		fieldPath := string(fd.Name())
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() == nil {
+				return true
+			}
+			v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+				err = appendUnknownFields(out, mv.Message(), fmt.Sprintf("%s[%q]", fieldPath, k.String()))
+				return err == nil
+			})
+		case fd.IsList():
+			if fd.Message() == nil {
+				return true
+			}
+			l := v.List()
+			for i := 0; i < l.Len() && err == nil; i++ {
+				err = appendUnknownFields(out, l.Get(i).Message(), fmt.Sprintf("%s[%d]", fieldPath, i))
+			}
+		case fd.Message() != nil:
+			err = appendUnknownFields(out, v.Message(), fieldPath)
+		}
+		return err == nil
+	})
+	return err
+}
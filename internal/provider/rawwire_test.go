@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	echo "github.com/salrashid123/grpc_wireformat/grpc_services/src/echo"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEncodeRawJSON(t *testing.T) {
+	b, err := encodeRawJSON(`{"1": "sal", "2": "mander", "3": {"1": "a"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &echo.EchoRequest{}
+	if err := proto.Unmarshal(b, got); err != nil {
+		t.Fatal(err)
+	}
+	want := &echo.EchoRequest{FirstName: "sal", LastName: "mander", MiddleName: &echo.Middle{Name: "a"}}
+	if !proto.Equal(got, want) {
+		t.Errorf("encodeRawJSON decoded to %v, want %v", got, want)
+	}
+}
+
+func TestEncodeRawJSON_types(t *testing.T) {
+	b, err := encodeRawJSON(`{"1": -1, "2:sint": -1, "3:fixed32": 7, "4:double": 1.5, "5": true, "6:bytes": "AAE=", "7": [1, 2]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []byte
+	want = protowire.AppendTag(want, 1, protowire.VarintType)
+	want = protowire.AppendVarint(want, 1<<64-1)
+	want = protowire.AppendTag(want, 2, protowire.VarintType)
+	want = protowire.AppendVarint(want, 1)
+	want = protowire.AppendTag(want, 3, protowire.Fixed32Type)
+	want = protowire.AppendFixed32(want, 7)
+	want = protowire.AppendTag(want, 4, protowire.Fixed64Type)
+	want = protowire.AppendFixed64(want, 0x3ff8000000000000)
+	want = protowire.AppendTag(want, 5, protowire.VarintType)
+	want = protowire.AppendVarint(want, 1)
+	want = protowire.AppendTag(want, 6, protowire.BytesType)
+	want = protowire.AppendBytes(want, []byte{0, 1})
+	want = protowire.AppendTag(want, 7, protowire.VarintType)
+	want = protowire.AppendVarint(want, 1)
+	want = protowire.AppendTag(want, 7, protowire.VarintType)
+	want = protowire.AppendVarint(want, 2)
+	if string(b) != string(want) {
+		t.Errorf("encodeRawJSON = %x, want %x", b, want)
+	}
+
+	_, err = encodeRawJSON(`{"first_name": "sal"}`)
+	if err == nil || !strings.Contains(err.Error(), "not a valid field number") {
+		t.Errorf("expected a field number error, got %v", err)
+	}
+}
+
+func TestDecodeRawMessage(t *testing.T) {
+	b, err := proto.Marshal(&echo.EchoRequest{FirstName: "sal", LastName: "mander", MiddleName: &echo.Middle{Name: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = protowire.AppendTag(b, 9, protowire.Fixed32Type)
+	b = protowire.AppendFixed32(b, 1)
+	b = protowire.AppendTag(b, 9, protowire.Fixed32Type)
+	b = protowire.AppendFixed32(b, 2)
+
+	m, err := decodeRawMessage(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := m.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"1":"sal","2":"mander","3":{"1":"a"},"9":[1,2]}`; string(j) != want {
+		t.Errorf("json = %s, want %s", j, want)
+	}
+	wantText := "1: \"sal\"\n2: \"mander\"\n3 {\n  1: \"a\"\n}\n9: 0x00000001\n9: 0x00000002\n"
+	if got := m.text(); got != wantText {
+		t.Errorf("text = %q, want %q", got, wantText)
+	}
+
+	if _, err := decodeRawMessage([]byte{0x0a, 0x05, 'a'}); err == nil {
+		t.Error("expected an error for a truncated message")
+	}
+}
+
+func TestCollectUnknownFields(t *testing.T) {
+	// a reply carrying field 7 that EchoReply does not define, nested inside field 3 of EchoRequest
+	var middle []byte
+	middle = protowire.AppendTag(middle, 1, protowire.BytesType)
+	middle = protowire.AppendString(middle, "a")
+	middle = protowire.AppendTag(middle, 7, protowire.VarintType)
+	middle = protowire.AppendVarint(middle, 42)
+	var b []byte
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendBytes(b, middle)
+	b = protowire.AppendTag(b, 9, protowire.BytesType)
+	b = protowire.AppendString(b, "new")
+
+	m := &echo.EchoRequest{}
+	if err := proto.Unmarshal(b, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := collectUnknownFields(m.ProtoReflect())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []unknownField{
+		{Path: "", Number: 9, WireType: "bytes", Value: `"new"`},
+		{Path: "middle_name", Number: 7, WireType: "varint", Value: "42"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("collectUnknownFields = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("collectUnknownFields[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var registryMu sync.Mutex
+
+// registerFiles loads the base64 encoded FileDescriptorSets from the registry_files
+// attribute at attr into the global registries
+func registerFiles(attr cty.Path, pbFiles []interface{}) (diags diag.Diagnostics) {
+	// terraform reads data sources in parallel
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for i, fileContentB64 := range pbFiles {
+		path := attr.IndexInt(i)
+
+		fc, ok := fileContentB64.(string)
+		if !ok {
+			return append(diags, diag.Errorf("Error converting filecontent to string")...)
+		}
+		fileDescriptors, err := parseRegistryFile(fc)
+		if err != nil {
+			return append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "Error loading registry file",
+				Detail:        err.Error(),
+				AttributePath: path,
+			})
+		}
+		for _, pb := range fileDescriptors.GetFile() {
+			// files loaded by an earlier read, or linked into the provider, are already usable
+			if _, err := protoregistry.GlobalFiles.FindFileByPath(pb.GetName()); err == nil {
+				continue
+			}
+			var fdr protoreflect.FileDescriptor
+			fdr, err = protodesc.NewFile(pb, protoregistry.GlobalFiles)
+			if err != nil {
+				return append(diags, diag.Diagnostic{
+					Severity:      diag.Error,
+					Summary:       "Error getting proto files",
+					Detail:        fmt.Sprintf("%s: %v", pb.GetName(), err),
+					AttributePath: path,
+				})
+			}
+			log.Printf("[DEBUG] loading package %s", fdr.Package().Name())
+
+			err = protoregistry.GlobalFiles.RegisterFile(fdr)
+			if err != nil {
+				return append(diags, diag.Diagnostic{
+					Severity:      diag.Error,
+					Summary:       "Error Registering proto file",
+					Detail:        fmt.Sprintf("%s: %v", pb.GetName(), err),
+					AttributePath: path,
+				})
+			}
+			for _, m := range pb.MessageType {
+				md := fdr.Messages().ByName(protoreflect.Name(*m.Name))
+				mdType := dynamicpb.NewMessageType(md)
+
+				err = protoregistry.GlobalTypes.RegisterMessage(mdType)
+				if err != nil {
+					return append(diags, diag.Errorf("Error registering message %s: %s", md.FullName(), err)...)
+				}
+			}
+		}
+	}
+
+	return diags
+}
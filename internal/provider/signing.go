@@ -0,0 +1,400 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	defaultCanonicalString = "{method}\n{path}\n{timestamp}\n{headers}\n{body_sha256}"
+
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+)
+
+// canonicalPlaceholder matches the placeholders of an hmac canonical_string
+var canonicalPlaceholder = regexp.MustCompile(`\{([a-z0-9_]+)\}`)
+
+// signingSchema is the signing block of the provider, an endpoint or a data source
+func signingSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"hmac": {
+					Type:     schema.TypeList,
+					Optional: true,
+					MaxItems: 1,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"secret": {
+								Type:      schema.TypeString,
+								Required:  true,
+								Sensitive: true,
+							},
+							"key_id": {
+								Type:     schema.TypeString,
+								Optional: true,
+							},
+							"canonical_string": {
+								Type:        schema.TypeString,
+								Optional:    true,
+								Default:     defaultCanonicalString,
+								Description: "String that is signed, with {method}, {authority}, {path}, {timestamp}, {headers} and {body_sha256} placeholders.",
+							},
+							"signed_headers": {
+								Type:     schema.TypeList,
+								Optional: true,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+								Description: "Metadata included as name:value lines in {headers}, in this order.",
+							},
+							"signature_header": {
+								Type:     schema.TypeString,
+								Optional: true,
+								Default:  "x-signature",
+							},
+							"key_id_header": {
+								Type:     schema.TypeString,
+								Optional: true,
+								Default:  "x-signature-key-id",
+							},
+							"timestamp_header": {
+								Type:     schema.TypeString,
+								Optional: true,
+								Default:  "x-signature-timestamp",
+							},
+							"signature_encoding": {
+								Type:         schema.TypeString,
+								Optional:     true,
+								Default:      "base64",
+								ValidateFunc: validation.StringInSlice([]string{"base64", "hex"}, false),
+							},
+						},
+					},
+				},
+				"aws_sigv4": {
+					Type:     schema.TypeList,
+					Optional: true,
+					MaxItems: 1,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"region": {
+								Type:     schema.TypeString,
+								Required: true,
+							},
+							"service": {
+								Type:     schema.TypeString,
+								Required: true,
+							},
+							"access_key_id": {
+								Type:        schema.TypeString,
+								Optional:    true,
+								Description: "Defaults to AWS_ACCESS_KEY_ID.",
+							},
+							"secret_access_key": {
+								Type:        schema.TypeString,
+								Optional:    true,
+								Sensitive:   true,
+								Description: "Defaults to AWS_SECRET_ACCESS_KEY.",
+							},
+							"session_token": {
+								Type:        schema.TypeString,
+								Optional:    true,
+								Sensitive:   true,
+								Description: "Defaults to AWS_SESSION_TOKEN.",
+							},
+							"signed_headers": {
+								Type:     schema.TypeList,
+								Optional: true,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+								Description: "Metadata signed in addition to host, content-type and the x-amz headers.",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// signingRequest is what a call sends, after framing
+type signingRequest struct {
+	Method    string
+	Authority string
+	Path      string
+	Headers   map[string]string
+	Body      []byte
+	Time      time.Time
+}
+
+// requestSigner returns the metadata that signs a call
+type requestSigner interface {
+	sign(r *signingRequest) (map[string]string, error)
+}
+
+// parseSigning reads a signing block; it returns nil when the block is not set
+func parseSigning(raw []interface{}) (requestSigner, error) {
+	if len(raw) == 0 || raw[0] == nil {
+		return nil, nil
+	}
+	c := raw[0].(map[string]interface{})
+
+	var signers []requestSigner
+	if h := c["hmac"].([]interface{}); len(h) > 0 && h[0] != nil {
+		s, err := parseHMACSigner(h[0].(map[string]interface{}))
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, s)
+	}
+	if a := c["aws_sigv4"].([]interface{}); len(a) > 0 && a[0] != nil {
+		s, err := parseSigV4Signer(a[0].(map[string]interface{}))
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, s)
+	}
+
+	if len(signers) != 1 {
+		return nil, fmt.Errorf("signing must set exactly one of hmac or aws_sigv4, got %d", len(signers))
+	}
+	return signers[0], nil
+}
+
+// hmacSigner signs a configurable canonical string with HMAC-SHA256
+type hmacSigner struct {
+	secret          []byte
+	keyID           string
+	canonical       string
+	signedHeaders   []string
+	signatureHeader string
+	keyIDHeader     string
+	timestampHeader string
+	encoding        string
+}
+
+func parseHMACSigner(c map[string]interface{}) (*hmacSigner, error) {
+	s := &hmacSigner{
+		secret:          []byte(c["secret"].(string)),
+		keyID:           c["key_id"].(string),
+		canonical:       c["canonical_string"].(string),
+		signatureHeader: strings.ToLower(c["signature_header"].(string)),
+		keyIDHeader:     strings.ToLower(c["key_id_header"].(string)),
+		timestampHeader: strings.ToLower(c["timestamp_header"].(string)),
+		encoding:        c["signature_encoding"].(string),
+	}
+	for _, h := range stringList(c["signed_headers"]) {
+		s.signedHeaders = append(s.signedHeaders, strings.ToLower(h))
+	}
+	for _, m := range canonicalPlaceholder.FindAllStringSubmatch(s.canonical, -1) {
+		switch m[1] {
+		case "method", "authority", "path", "timestamp", "headers", "body_sha256":
+		default:
+			return nil, fmt.Errorf("hmac canonical_string has unknown placeholder %s", m[0])
+		}
+	}
+	if s.signatureHeader == "" {
+		return nil, fmt.Errorf("hmac signature_header must be set")
+	}
+	return s, nil
+}
+
+// canonicalString fills the placeholders of the canonical string for r
+func (s *hmacSigner) canonicalString(r *signingRequest) string {
+	bodySum := sha256.Sum256(r.Body)
+	return canonicalPlaceholder.ReplaceAllStringFunc(s.canonical, func(p string) string {
+		switch p {
+		case "{method}":
+			return r.Method
+		case "{authority}":
+			return r.Authority
+		case "{path}":
+			return r.Path
+		case "{timestamp}":
+			return strconv.FormatInt(r.Time.Unix(), 10)
+		case "{headers}":
+			lines := make([]string, 0, len(s.signedHeaders))
+			for _, h := range s.signedHeaders {
+				lines = append(lines, h+":"+strings.TrimSpace(r.Headers[h]))
+			}
+			return strings.Join(lines, "\n")
+		case "{body_sha256}":
+			return hex.EncodeToString(bodySum[:])
+		}
+		return p
+	})
+}
+
+func (s *hmacSigner) sign(r *signingRequest) (map[string]string, error) {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(s.canonicalString(r)))
+	sum := mac.Sum(nil)
+
+	md := map[string]string{}
+	if s.encoding == "hex" {
+		md[s.signatureHeader] = hex.EncodeToString(sum)
+	} else {
+		md[s.signatureHeader] = base64.StdEncoding.EncodeToString(sum)
+	}
+	if s.keyID != "" && s.keyIDHeader != "" {
+		md[s.keyIDHeader] = s.keyID
+	}
+	if s.timestampHeader != "" {
+		md[s.timestampHeader] = strconv.FormatInt(r.Time.Unix(), 10)
+	}
+	return md, nil
+}
+
+// sigV4Signer signs calls with AWS Signature Version 4
+type sigV4Signer struct {
+	region          string
+	service         string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	signedHeaders   []string
+}
+
+func parseSigV4Signer(c map[string]interface{}) (*sigV4Signer, error) {
+	s := &sigV4Signer{
+		region:          c["region"].(string),
+		service:         c["service"].(string),
+		accessKeyID:     c["access_key_id"].(string),
+		secretAccessKey: c["secret_access_key"].(string),
+		sessionToken:    c["session_token"].(string),
+	}
+	if s.accessKeyID == "" && s.secretAccessKey == "" {
+		s.accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		s.secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if s.sessionToken == "" {
+			s.sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+	}
+	if s.accessKeyID == "" || s.secretAccessKey == "" {
+		return nil, fmt.Errorf("aws_sigv4 needs access_key_id and secret_access_key, or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	for _, h := range stringList(c["signed_headers"]) {
+		s.signedHeaders = append(s.signedHeaders, strings.ToLower(h))
+	}
+	return s, nil
+}
+
+func (s *sigV4Signer) sign(r *signingRequest) (map[string]string, error) {
+	bodySum := sha256.Sum256(r.Body)
+	payloadHash := hex.EncodeToString(bodySum[:])
+	amzDate := r.Time.UTC().Format(sigV4TimeFormat)
+
+	md := map[string]string{
+		"x-amz-date":           amzDate,
+		"x-amz-content-sha256": payloadHash,
+	}
+	if s.sessionToken != "" {
+		md["x-amz-security-token"] = s.sessionToken
+	}
+
+	signed := map[string]string{
+		"host":         r.Authority,
+		"content-type": r.Headers["content-type"],
+	}
+	for k, v := range md {
+		signed[k] = v
+	}
+	for _, h := range s.signedHeaders {
+		signed[h] = r.Headers[h]
+	}
+
+	md["authorization"] = sigV4Authorization(r.Method, r.Path, signed, payloadHash, r.Time, s.region, s.service, s.accessKeyID, s.secretAccessKey)
+	return md, nil
+}
+
+// sigV4Authorization is the authorization header for a request without query
+// parameters that signs headers
+func sigV4Authorization(method, path string, headers map[string]string, payloadHash string, t time.Time, region, service, accessKeyID, secretAccessKey string) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.Join(strings.Fields(headers[name]), " ") + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		sigV4EscapePath(path),
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	date := t.UTC().Format("20060102")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestSum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		t.UTC().Format(sigV4TimeFormat),
+		scope,
+		hex.EncodeToString(requestSum[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s", sigV4Algorithm, accessKeyID, scope, signedHeaders, signature)
+}
+
+// sigV4EscapePath URI encodes each path segment twice, as SigV4 does for every service but S3
+func sigV4EscapePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = sigV4Escape(sigV4Escape(segment))
+	}
+	return strings.Join(segments, "/")
+}
+
+// sigV4Escape percent encodes everything but the RFC 3986 unreserved characters
+func sigV4Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,190 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testHMACConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"secret":             "s3cr3t",
+		"key_id":             "key-1",
+		"canonical_string":   defaultCanonicalString,
+		"signed_headers":     []interface{}{"X-Tenant", "content-type"},
+		"signature_header":   "x-signature",
+		"key_id_header":      "x-signature-key-id",
+		"timestamp_header":   "x-signature-timestamp",
+		"signature_encoding": "base64",
+	}
+}
+
+func TestHMACSigner(t *testing.T) {
+	s, err := parseHMACSigner(testHMACConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte{0, 0, 0, 0, 2, 10, 0}
+	r := &signingRequest{
+		Method:    "POST",
+		Authority: "localhost:8081",
+		Path:      "/echo.EchoServer/SayHello",
+		Headers:   map[string]string{"x-tenant": " billing ", "content-type": "application/grpc", "te": "trailers"},
+		Body:      body,
+		Time:      time.Unix(1700000000, 0),
+	}
+
+	bodySum := sha256.Sum256(body)
+	want := "POST\n/echo.EchoServer/SayHello\n1700000000\nx-tenant:billing\ncontent-type:application/grpc\n" + hex.EncodeToString(bodySum[:])
+	if got := s.canonicalString(r); got != want {
+		t.Errorf("canonical string = %q, want %q", got, want)
+	}
+
+	md, err := s.sign(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	mac.Write([]byte(want))
+	if md["x-signature"] != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("x-signature = %q", md["x-signature"])
+	}
+	if md["x-signature-key-id"] != "key-1" || md["x-signature-timestamp"] != "1700000000" {
+		t.Errorf("metadata = %v", md)
+	}
+
+	// a different body gets a different signature
+	r.Body = []byte{0, 0, 0, 0, 0}
+	other, err := s.sign(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other["x-signature"] == md["x-signature"] {
+		t.Error("signature does not cover the body")
+	}
+
+	c := testHMACConfig()
+	c["canonical_string"] = "{authority}|{path}"
+	c["signature_encoding"] = "hex"
+	c["timestamp_header"] = ""
+	s, err = parseHMACSigner(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.canonicalString(r); got != "localhost:8081|/echo.EchoServer/SayHello" {
+		t.Errorf("canonical string = %q", got)
+	}
+	md, err = s.sign(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hex.DecodeString(md["x-signature"]); err != nil || len(md["x-signature"]) != 64 {
+		t.Errorf("x-signature %q is not hex", md["x-signature"])
+	}
+	if _, ok := md["x-signature-timestamp"]; ok {
+		t.Error("timestamp sent with an empty timestamp_header")
+	}
+
+	c["canonical_string"] = "{method} {query}"
+	if _, err := parseHMACSigner(c); err == nil || !strings.Contains(err.Error(), "unknown placeholder {query}") {
+		t.Errorf("got error %v for an unknown placeholder", err)
+	}
+}
+
+func TestSigV4Authorization(t *testing.T) {
+	// post-vanilla from the AWS Signature Version 4 test suite
+	emptySum := sha256.Sum256(nil)
+	got := sigV4Authorization("POST", "/", map[string]string{
+		"host":       "example.amazonaws.com",
+		"x-amz-date": "20150830T123600Z",
+	}, hex.EncodeToString(emptySum[:]), time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC),
+		"us-east-1", "service", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"
+	if got != want {
+		t.Errorf("authorization = %q, want %q", got, want)
+	}
+}
+
+func TestSigV4Signer(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+
+	s, err := parseSigV4Signer(map[string]interface{}{
+		"region":            "us-west-2",
+		"service":           "execute-api",
+		"access_key_id":     "",
+		"secret_access_key": "",
+		"session_token":     "",
+		"signed_headers":    []interface{}{"X-Tenant"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := s.sign(&signingRequest{
+		Method:    "POST",
+		Authority: "api.example.com",
+		Path:      "/echo.EchoServer/SayHello",
+		Headers:   map[string]string{"x-tenant": "billing", "content-type": "application/grpc"},
+		Body:      []byte{0, 0, 0, 0, 0},
+		Time:      time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bodySum := sha256.Sum256([]byte{0, 0, 0, 0, 0})
+	if md["x-amz-date"] != "20261019T120000Z" || md["x-amz-security-token"] != "session" || md["x-amz-content-sha256"] != hex.EncodeToString(bodySum[:]) {
+		t.Errorf("metadata = %v", md)
+	}
+	wantPrefix := "AWS4-HMAC-SHA256 Credential=AKIDENV/20261019/us-west-2/execute-api/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date;x-amz-security-token;x-tenant, Signature="
+	if !strings.HasPrefix(md["authorization"], wantPrefix) {
+		t.Errorf("authorization = %q", md["authorization"])
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	if _, err := parseSigV4Signer(map[string]interface{}{
+		"region": "us-west-2", "service": "execute-api", "access_key_id": "", "secret_access_key": "", "session_token": "", "signed_headers": []interface{}{},
+	}); err == nil {
+		t.Error("expected an error without credentials")
+	}
+}
+
+func TestSigV4EscapePath(t *testing.T) {
+	tests := map[string]string{
+		"":                          "/",
+		"/":                         "/",
+		"/echo.EchoServer/SayHello": "/echo.EchoServer/SayHello",
+		"/a b/c":                    "/a%2520b/c",
+	}
+	for in, want := range tests {
+		if got := sigV4EscapePath(in); got != want {
+			t.Errorf("sigV4EscapePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseSigning(t *testing.T) {
+	if s, err := parseSigning(nil); s != nil || err != nil {
+		t.Errorf("got %v, %v for no signing block", s, err)
+	}
+	if _, err := parseSigning([]interface{}{map[string]interface{}{
+		"hmac":      []interface{}{},
+		"aws_sigv4": []interface{}{},
+	}}); err == nil {
+		t.Error("expected an error for an empty signing block")
+	}
+	s, err := parseSigning([]interface{}{map[string]interface{}{
+		"hmac":      []interface{}{testHMACConfig()},
+		"aws_sigv4": []interface{}{},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.(*hmacSigner); !ok {
+		t.Errorf("got %T, want an hmac signer", s)
+	}
+}
@@ -0,0 +1,260 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+	"github.com/spiffe/go-spiffe/v2/svid/jwtsvid"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+)
+
+// spiffeFetchTimeout bounds the wait for the Workload API to hand out the first SVID
+const spiffeFetchTimeout = 30 * time.Second
+
+// spiffeSchema is the spiffe block of the provider or an endpoint
+func spiffeSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"workload_api_socket": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "Workload API address, eg unix:///run/spire/sockets/agent.sock. Defaults to SPIFFE_ENDPOINT_SOCKET.",
+				},
+				"server_id": {
+					Type:             schema.TypeString,
+					Optional:         true,
+					ValidateDiagFunc: validateSPIFFEID,
+					Description:      "SPIFFE ID the server must present, default any ID in the trust domain of the X.509-SVID.",
+				},
+				"mtls": {
+					Type:        schema.TypeBool,
+					Optional:    true,
+					Default:     true,
+					Description: "Present the X.509-SVID as client certificate.",
+				},
+			},
+		},
+	}
+}
+
+// spiffeConfig verifies servers with the trust bundle from the Workload API and
+// authenticates with the X.509-SVID, in place of ca
+type spiffeConfig struct {
+	Socket   string
+	ServerID string
+	MTLS     bool
+}
+
+// parseSPIFFE reads a spiffe block; it returns nil when the block is not set
+func parseSPIFFE(raw []interface{}) *spiffeConfig {
+	if len(raw) == 0 {
+		return nil
+	}
+	// every argument is optional, an empty block is a nil element
+	c, ok := raw[0].(map[string]interface{})
+	if !ok {
+		return &spiffeConfig{MTLS: true}
+	}
+	return &spiffeConfig{
+		Socket:   c["workload_api_socket"].(string),
+		ServerID: c["server_id"].(string),
+		MTLS:     c["mtls"].(bool),
+	}
+}
+
+// key is the part of the transportKey that depends on the spiffe settings
+func (c *spiffeConfig) key() string {
+	if c == nil {
+		return ""
+	}
+	return fmt.Sprintf("%q %q %t", c.Socket, c.ServerID, c.MTLS)
+}
+
+func validateSPIFFEID(v interface{}, path cty.Path) diag.Diagnostics {
+	id, ok := v.(string)
+	if !ok || id == "" {
+		return nil
+	}
+	if _, err := spiffeid.FromString(id); err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid SPIFFE ID",
+			Detail:        fmt.Sprintf("%q: %v", id, err),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
+
+func workloadAPIOptions(socket string) []workloadapi.ClientOption {
+	if socket == "" {
+		// the client falls back to SPIFFE_ENDPOINT_SOCKET
+		return nil
+	}
+	return []workloadapi.ClientOption{workloadapi.WithAddr(socket)}
+}
+
+// spiffeSources keeps one X.509 source per Workload API socket for the lifetime
+// of the provider; sources watch the socket so rotated SVIDs are picked up
+type spiffeSources struct {
+	mu      sync.Mutex
+	sources map[string]*workloadapi.X509Source
+}
+
+func newSPIFFESources() *spiffeSources {
+	return &spiffeSources{sources: map[string]*workloadapi.X509Source{}}
+}
+
+func (s *spiffeSources) x509Source(ctx context.Context, socket string) (*workloadapi.X509Source, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if source, ok := s.sources[socket]; ok {
+		return source, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, spiffeFetchTimeout)
+	defer cancel()
+	source, err := workloadapi.NewX509Source(ctx, workloadapi.WithClientOptions(workloadAPIOptions(socket)...))
+	if err != nil {
+		return nil, fmt.Errorf("fetching X.509-SVID from the Workload API %s: %v", socketName(socket), err)
+	}
+	s.sources[socket] = source
+	return source, nil
+}
+
+// tlsConfig returns a client config that verifies the server SPIFFE ID instead of its hostname
+func (s *spiffeSources) tlsConfig(ctx context.Context, c *spiffeConfig) (*tls.Config, error) {
+	source, err := s.x509Source(ctx, c.Socket)
+	if err != nil {
+		return nil, err
+	}
+
+	var authorizer tlsconfig.Authorizer
+	if c.ServerID != "" {
+		id, err := spiffeid.FromString(c.ServerID)
+		if err != nil {
+			return nil, err
+		}
+		authorizer = tlsconfig.AuthorizeID(id)
+	} else {
+		svid, err := source.GetX509SVID()
+		if err != nil {
+			return nil, err
+		}
+		authorizer = tlsconfig.AuthorizeMemberOf(svid.ID.TrustDomain())
+	}
+
+	if c.MTLS {
+		return tlsconfig.MTLSClientConfig(source, source, authorizer), nil
+	}
+	return tlsconfig.TLSClientConfig(source, authorizer), nil
+}
+
+func socketName(socket string) string {
+	if socket == "" {
+		return "at SPIFFE_ENDPOINT_SOCKET"
+	}
+	return socket
+}
+
+// spiffeJWTSchema is the spiffe_jwt block of credentials
+func spiffeJWTSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"workload_api_socket": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "Workload API address, defaults to SPIFFE_ENDPOINT_SOCKET.",
+				},
+				"audience": {
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+					Description: "Audiences of the JWT-SVID, default the service url, eg https://host/echo.EchoServer.",
+				},
+			},
+		},
+	}
+}
+
+// spiffeJWTSource fetches JWT-SVIDs from the Workload API, one per audience
+type spiffeJWTSource struct {
+	socket    string
+	audiences []string
+	tokens    *tokenCache
+}
+
+func parseSPIFFEJWT(c map[string]interface{}, tokens *tokenCache) *spiffeJWTSource {
+	socket, _ := c["workload_api_socket"].(string)
+	return &spiffeJWTSource{
+		socket:    socket,
+		audiences: stringList(c["audience"]),
+		tokens:    tokens,
+	}
+}
+
+func (s *spiffeJWTSource) metadata(ctx context.Context, rawURL string) (map[string]string, error) {
+	audiences := s.audiences
+	if len(audiences) == 0 {
+		aud, err := serviceAudience(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		audiences = []string{aud}
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "spiffe_jwt\n%q\n%q\n", s.socket, strings.Join(audiences, "\n"))
+	token, err := s.tokens.get(hex.EncodeToString(h.Sum(nil)), func() (*cachedToken, error) {
+		return s.fetch(ctx, audiences)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": token.value}, nil
+}
+
+func (s *spiffeJWTSource) fetch(ctx context.Context, audiences []string) (*cachedToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, spiffeFetchTimeout)
+	defer cancel()
+
+	client, err := workloadapi.New(ctx, workloadAPIOptions(s.socket)...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the Workload API %s: %v", socketName(s.socket), err)
+	}
+	defer client.Close()
+
+	svid, err := client.FetchJWTSVID(ctx, jwtsvid.Params{
+		Audience:       audiences[0],
+		ExtraAudiences: audiences[1:],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWT-SVID for %s from the Workload API %s: %v", strings.Join(audiences, ", "), socketName(s.socket), err)
+	}
+	lifetime := time.Until(svid.Expiry)
+	if lifetime <= 0 {
+		return nil, fmt.Errorf("the Workload API returned a JWT-SVID for %s that expired at %s", svid.ID, svid.Expiry)
+	}
+	return newCachedToken("Bearer "+svid.Marshal(), lifetime), nil
+}
@@ -0,0 +1,267 @@
+package provider
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
+	"google.golang.org/grpc"
+)
+
+// testSVID is a certificate and key issued by the test trust domain
+type testSVID struct {
+	id   string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func (s *testSVID) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{s.cert.Raw}, PrivateKey: s.key, Leaf: s.cert}
+}
+
+// testTrustDomain is the CA of spiffe://example.org
+type testTrustDomain struct {
+	testSVID
+}
+
+func newTestTrustDomain(t *testing.T) *testTrustDomain {
+	td := &testTrustDomain{}
+	td.testSVID = *td.issue(t, "spiffe://example.org", true)
+	return td
+}
+
+// issue returns an SVID for id signed by the trust domain, or a self-signed CA
+func (td *testTrustDomain) issue(t *testing.T, id string, ca bool) *testSVID {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{Organization: []string{"SPIFFE"}},
+		URIs:         []*url.URL{u},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	parent, signer := template, key
+	if ca {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+		parent, signer = td.cert, td.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSVID{id: id, cert: cert, key: key}
+}
+
+// serverTLSConfig requires client certificates from the trust domain
+func (td *testTrustDomain) serverTLSConfig(server *testSVID) *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(td.cert)
+	return &tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate()},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		NextProtos:   []string{"h2"},
+	}
+}
+
+// fakeWorkloadAPI serves one X.509-SVID and signs JWT-SVIDs for the workload
+type fakeWorkloadAPI struct {
+	workload.UnimplementedSpiffeWorkloadAPIServer
+
+	td        *testTrustDomain
+	svid      *testSVID
+	jwtSigner *jwtSource
+	jwtCalls  int32
+	socket    string
+	server    *grpc.Server
+}
+
+func startFakeWorkloadAPI(t *testing.T, td *testTrustDomain, id string) *fakeWorkloadAPI {
+	// unix socket paths are short, t.TempDir can be too long
+	dir, err := os.MkdirTemp("", "spiffe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svid := td.issue(t, id, false)
+	f := &fakeWorkloadAPI{
+		td:   td,
+		svid: svid,
+		jwtSigner: &jwtSource{
+			key:      svid.key,
+			alg:      "ES256",
+			issuer:   "spiffe://example.org",
+			subject:  id,
+			lifetime: time.Hour,
+			claims:   map[string]string{},
+		},
+		socket: "unix://" + path,
+		server: grpc.NewServer(),
+	}
+	workload.RegisterSpiffeWorkloadAPIServer(f.server, f)
+	go f.server.Serve(l)
+	t.Cleanup(f.server.Stop)
+	return f
+}
+
+func (f *fakeWorkloadAPI) FetchX509SVID(_ *workload.X509SVIDRequest, stream workload.SpiffeWorkloadAPI_FetchX509SVIDServer) error {
+	key, err := x509.MarshalPKCS8PrivateKey(f.svid.key)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&workload.X509SVIDResponse{
+		Svids: []*workload.X509SVID{{
+			SpiffeId:    f.svid.id,
+			X509Svid:    f.svid.cert.Raw,
+			X509SvidKey: key,
+			Bundle:      f.td.cert.Raw,
+		}},
+	}); err != nil {
+		return err
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+func (f *fakeWorkloadAPI) FetchJWTSVID(_ context.Context, req *workload.JWTSVIDRequest) (*workload.JWTSVIDResponse, error) {
+	atomic.AddInt32(&f.jwtCalls, 1)
+	token, err := f.jwtSigner.sign(strings.Join(req.Audience, " "), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &workload.JWTSVIDResponse{
+		Svids: []*workload.JWTSVID{{SpiffeId: f.svid.id, Svid: token}},
+	}, nil
+}
+
+func TestSPIFFETLSConfig(t *testing.T) {
+	td := newTestTrustDomain(t)
+	api := startFakeWorkloadAPI(t, td, "spiffe://example.org/terraform")
+	server := td.issue(t, "spiffe://example.org/echo", false)
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", td.serverTLSConfig(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	peers := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			tc := conn.(*tls.Conn)
+			if tc.Handshake() == nil && len(tc.ConnectionState().PeerCertificates) > 0 {
+				peers <- tc.ConnectionState().PeerCertificates[0].URIs[0].String()
+			}
+			conn.Close()
+		}
+	}()
+
+	sources := newSPIFFESources()
+	tests := []struct {
+		name    string
+		config  *spiffeConfig
+		wantErr string
+	}{
+		{"server id", &spiffeConfig{Socket: api.socket, ServerID: "spiffe://example.org/echo", MTLS: true}, ""},
+		{"trust domain", &spiffeConfig{Socket: api.socket, MTLS: true}, ""},
+		{"wrong server id", &spiffeConfig{Socket: api.socket, ServerID: "spiffe://example.org/billing", MTLS: true}, `unexpected ID "spiffe://example.org/echo"`},
+		{"no client certificate", &spiffeConfig{Socket: api.socket, MTLS: false}, "certificate required"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := sources.tlsConfig(context.Background(), tc.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := tls.Dial("tcp", l.Addr().String(), cfg)
+			if err == nil {
+				// the server rejects a missing client certificate after the client handshake is done
+				_, err = conn.Read(make([]byte, 1))
+				conn.Close()
+			}
+			if tc.wantErr == "" {
+				if peer := <-peers; peer != "spiffe://example.org/terraform" {
+					t.Errorf("server saw client %q", peer)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+	if len(sources.sources) != 1 {
+		t.Errorf("got %d X.509 sources for one socket, want 1", len(sources.sources))
+	}
+
+	// the source keeps retrying a missing socket until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := newSPIFFESources().tlsConfig(ctx, &spiffeConfig{Socket: "unix:///nonexistent/agent.sock"}); err == nil || !strings.Contains(err.Error(), "unix:///nonexistent/agent.sock") {
+		t.Errorf("got error %v for a missing socket", err)
+	}
+}
+
+func TestSPIFFEJWTSource(t *testing.T) {
+	td := newTestTrustDomain(t)
+	api := startFakeWorkloadAPI(t, td, "spiffe://example.org/terraform")
+
+	s := parseSPIFFEJWT(map[string]interface{}{"workload_api_socket": api.socket, "audience": []interface{}{}}, newTokenCache())
+	for i := 0; i < 3; i++ {
+		md, err := s.metadata(context.Background(), "https://billing.internal/billing.Ledger/Post")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, claims := verifyJWT(t, strings.TrimPrefix(md["authorization"], "Bearer "), &api.svid.key.PublicKey)
+		if claims["sub"] != "spiffe://example.org/terraform" || claims["aud"] != "https://billing.internal/billing.Ledger" {
+			t.Errorf("claims = %v", claims)
+		}
+	}
+	if api.jwtCalls != 1 {
+		t.Errorf("got %d JWT-SVID fetches, want 1", api.jwtCalls)
+	}
+
+	// an empty spiffe_jwt block
+	if s := parseSPIFFEJWT(nil, newTokenCache()); s.socket != "" || len(s.audiences) != 0 {
+		t.Errorf("empty block parsed as %+v", s)
+	}
+}
@@ -0,0 +1,262 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshHandshakeTimeout bounds connecting and authenticating to the jump host
+const sshHandshakeTimeout = 30 * time.Second
+
+// sshTunnelSchema is the ssh_tunnel block of the provider or an endpoint
+func sshTunnelSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"host": {
+					Type:        schema.TypeString,
+					Required:    true,
+					Description: "host[:port] of the SSH jump host, port 22 by default.",
+				},
+				"user": {
+					Type:        schema.TypeString,
+					Required:    true,
+					Description: "User to log in to the jump host as.",
+				},
+				"private_key": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Sensitive:   true,
+					Description: "PEM or OpenSSH encoded private key.",
+				},
+				"private_key_passphrase": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Sensitive:   true,
+					Description: "Passphrase of an encrypted private_key.",
+				},
+				"agent_socket": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "SSH agent socket to authenticate with, default SSH_AUTH_SOCK when private_key is not set.",
+				},
+				"known_hosts_file": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "known_hosts file the jump host key is checked against, default ~/.ssh/known_hosts.",
+				},
+			},
+		},
+	}
+}
+
+// sshTunnelConfig dials targets through direct-tcpip channels of an SSH jump host
+type sshTunnelConfig struct {
+	Host           string
+	User           string
+	PrivateKey     string
+	Passphrase     string
+	AgentSocket    string
+	KnownHostsFile string
+}
+
+// parseSSHTunnel reads an ssh_tunnel block; it returns nil when the block is not set
+func parseSSHTunnel(raw []interface{}) (*sshTunnelConfig, error) {
+	if len(raw) == 0 || raw[0] == nil {
+		return nil, nil
+	}
+	c := raw[0].(map[string]interface{})
+	host := c["host"].(string)
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	if h, _, _ := net.SplitHostPort(host); h == "" {
+		return nil, fmt.Errorf("host %q must be host[:port]", c["host"].(string))
+	}
+	config := &sshTunnelConfig{
+		Host:           host,
+		User:           c["user"].(string),
+		PrivateKey:     c["private_key"].(string),
+		Passphrase:     c["private_key_passphrase"].(string),
+		AgentSocket:    c["agent_socket"].(string),
+		KnownHostsFile: c["known_hosts_file"].(string),
+	}
+	if config.PrivateKey != "" {
+		if _, err := config.signer(); err != nil {
+			return nil, err
+		}
+	} else if config.AgentSocket == "" {
+		config.AgentSocket = os.Getenv("SSH_AUTH_SOCK")
+		if config.AgentSocket == "" {
+			return nil, fmt.Errorf("set private_key or agent_socket, SSH_AUTH_SOCK is not set")
+		}
+	}
+	if config.KnownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("known_hosts_file is not set and there is no home directory: %v", err)
+		}
+		config.KnownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	return config, nil
+}
+
+func (c *sshTunnelConfig) signer() (ssh.Signer, error) {
+	if c.Passphrase != "" {
+		s, err := ssh.ParsePrivateKeyWithPassphrase([]byte(c.PrivateKey), []byte(c.Passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("private_key: %v", err)
+		}
+		return s, nil
+	}
+	s, err := ssh.ParsePrivateKey([]byte(c.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("private_key: %v", err)
+	}
+	return s, nil
+}
+
+// key is the part of the transportKey that depends on the tunnel, without the key itself
+func (c *sshTunnelConfig) key() string {
+	if c == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s@%s %x %q %q", c.User, c.Host, sha256.Sum256([]byte(c.PrivateKey+"\x00"+c.Passphrase)), c.AgentSocket, c.KnownHostsFile)
+}
+
+// sshTunnel is the jump host a dialTarget connects through
+type sshTunnel struct {
+	config  *sshTunnelConfig
+	clients *sshClients
+}
+
+func (t *sshTunnel) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	return t.clients.dial(ctx, t.config, network, addr)
+}
+
+// sshClients keeps one SSH connection per jump host and login for the lifetime of
+// the provider, every target reached through the host shares it
+type sshClients struct {
+	mu      sync.Mutex
+	clients map[string]*ssh.Client
+}
+
+func newSSHClients() *sshClients {
+	return &sshClients{clients: map[string]*ssh.Client{}}
+}
+
+// dial opens a channel to addr, reconnecting once when the cached connection is gone
+func (s *sshClients) dial(ctx context.Context, c *sshTunnelConfig, network, addr string) (net.Conn, error) {
+	client, err := s.client(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.DialContext(ctx, network, addr)
+	var rejected *ssh.OpenChannelError
+	if err != nil && !errors.As(err, &rejected) && ctx.Err() == nil {
+		s.drop(c, client)
+		if client, err = s.client(ctx, c); err != nil {
+			return nil, err
+		}
+		conn, err = client.DialContext(ctx, network, addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ssh_tunnel %s to %s: %v", c.Host, addr, err)
+	}
+	return conn, nil
+}
+
+func (s *sshClients) client(ctx context.Context, c *sshTunnelConfig) (*ssh.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if client, ok := s.clients[c.key()]; ok {
+		return client, nil
+	}
+	client, err := connectSSH(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("ssh_tunnel %s: %v", c.Host, err)
+	}
+	s.clients[c.key()] = client
+	return client, nil
+}
+
+func (s *sshClients) drop(c *sshTunnelConfig, client *ssh.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clients[c.key()] == client {
+		delete(s.clients, c.key())
+	}
+	client.Close()
+}
+
+// connectSSH logs in to the jump host after checking its key against known_hosts
+func connectSSH(ctx context.Context, c *sshTunnelConfig) (*ssh.Client, error) {
+	hostKeys, err := knownhosts.New(c.KnownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("known_hosts_file: %v", err)
+	}
+	var auth []ssh.AuthMethod
+	var agentConn net.Conn
+	if c.PrivateKey != "" {
+		signer, err := c.signer()
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if c.AgentSocket != "" {
+		// the agent connection lives as long as the SSH connection it signed for
+		if agentConn, err = (&net.Dialer{}).DialContext(ctx, "unix", c.AgentSocket); err != nil {
+			return nil, fmt.Errorf("ssh agent %s: %v", c.AgentSocket, err)
+		}
+		auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sshHandshakeTimeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", c.Host)
+	if err != nil {
+		if agentConn != nil {
+			agentConn.Close()
+		}
+		return nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, c.Host, &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+	})
+	if err != nil {
+		conn.Close()
+		if agentConn != nil {
+			agentConn.Close()
+		}
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	client := ssh.NewClient(sshConn, chans, reqs)
+	if agentConn != nil {
+		go func() {
+			client.Wait()
+			agentConn.Close()
+		}()
+	}
+	return client, nil
+}
@@ -0,0 +1,257 @@
+package provider
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer is a jump host that forwards direct-tcpip channels for one client key
+type testSSHServer struct {
+	addr       string
+	knownHosts string
+	handshakes int32
+
+	mu    sync.Mutex
+	conns []*ssh.ServerConn
+}
+
+func newTestSSHServer(t *testing.T, authorized ssh.PublicKey) *testSSHServer {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(authorized.Marshal()) {
+				return nil, io.EOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := &testSSHServer{addr: l.Addr().String()}
+	s.knownHosts = writeTestFile(t, "known_hosts", []byte(knownhosts.Line([]string{knownhosts.Normalize(s.addr)}, hostSigner.PublicKey())+"\n"))
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	atomic.AddInt32(&s.handshakes, 1)
+	s.mu.Lock()
+	s.conns = append(s.conns, sconn)
+	s.mu.Unlock()
+	go ssh.DiscardRequests(reqs)
+	for ch := range chans {
+		if ch.ChannelType() != "direct-tcpip" {
+			ch.Reject(ssh.UnknownChannelType, ch.ChannelType())
+			continue
+		}
+		var target struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(ch.ExtraData(), &target); err != nil {
+			ch.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			ch.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, requests, err := ch.Accept()
+		if err != nil {
+			upstream.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			defer channel.Close()
+			defer upstream.Close()
+			go io.Copy(channel, upstream)
+			io.Copy(upstream, channel)
+		}()
+	}
+}
+
+// closeAll drops every client connection, like a jump host restart
+func (s *testSSHServer) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+// newTestSSHKey returns an OpenSSH encoded ed25519 private key and its signer
+func newTestSSHKey(t *testing.T) (string, ssh.Signer) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(block)), signer
+}
+
+func TestParseSSHTunnel(t *testing.T) {
+	key, _ := newTestSSHKey(t)
+	block := func(host, key string) []interface{} {
+		return []interface{}{map[string]interface{}{
+			"host": host, "user": "deploy", "private_key": key, "private_key_passphrase": "",
+			"agent_socket": "", "known_hosts_file": "/etc/ssh/ssh_known_hosts",
+		}}
+	}
+
+	c, err := parseSSHTunnel(block("bastion.internal", key))
+	if err != nil || c.Host != "bastion.internal:22" {
+		t.Errorf("parseSSHTunnel = %+v, %v", c, err)
+	}
+	if c, err := parseSSHTunnel(nil); c != nil || err != nil {
+		t.Errorf("parseSSHTunnel(nil) = %+v, %v", c, err)
+	}
+	if _, err := parseSSHTunnel(block("bastion.internal:2222", "not a key")); err == nil || !strings.Contains(err.Error(), "private_key") {
+		t.Errorf("got error %v for a bad private_key", err)
+	}
+
+	// an empty SSH_AUTH_SOCK counts as unset
+	t.Setenv("SSH_AUTH_SOCK", "")
+	if _, err := parseSSHTunnel(block("bastion.internal", "")); err == nil || !strings.Contains(err.Error(), "SSH_AUTH_SOCK") {
+		t.Errorf("got error %v without a key or agent", err)
+	}
+	t.Setenv("SSH_AUTH_SOCK", "/run/agent.sock")
+	if c, err := parseSSHTunnel(block("bastion.internal", "")); err != nil || c.AgentSocket != "/run/agent.sock" {
+		t.Errorf("parseSSHTunnel with SSH_AUTH_SOCK = %+v, %v", c, err)
+	}
+}
+
+func TestSSHTunnelDial(t *testing.T) {
+	upstream := echoListener(t)
+	defer upstream.Close()
+	key, signer := newTestSSHKey(t)
+	server := newTestSSHServer(t, signer.PublicKey())
+
+	// an agent holding the same key on a unix socket
+	dir, err := os.MkdirTemp("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyring := agent.NewKeyring()
+	raw, err := ssh.ParseRawPrivateKey([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Add(agent.AddedKey{PrivateKey: raw}); err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "agent.sock")
+	agentListener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agentListener.Close()
+	go func() {
+		for {
+			conn, err := agentListener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+
+	clients := newSSHClients()
+	ping := func(c *sshTunnelConfig) error {
+		target, err := parseTarget(upstream.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		target.tunnel = &sshTunnel{config: c, clients: clients}
+		conn, err := target.dial(context.Background())
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.Write([]byte("ping"))
+		got := make([]byte, 4)
+		if _, err := io.ReadFull(conn, got); err != nil || string(got) != "ping" {
+			t.Errorf("read %q, %v through the tunnel", got, err)
+		}
+		return nil
+	}
+
+	withKey := &sshTunnelConfig{Host: server.addr, User: "deploy", PrivateKey: key, KnownHostsFile: server.knownHosts}
+	for i := 0; i < 3; i++ {
+		if err := ping(withKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&server.handshakes); n != 1 {
+		t.Errorf("%d ssh handshakes for three dials, want the connection reused", n)
+	}
+
+	// a dropped connection is replaced on the next dial
+	server.closeAll()
+	if err := ping(withKey); err != nil {
+		t.Errorf("dial after the jump host dropped the connection: %v", err)
+	}
+
+	if err := ping(&sshTunnelConfig{Host: server.addr, User: "deploy", AgentSocket: socket, KnownHostsFile: server.knownHosts}); err != nil {
+		t.Errorf("dial with the agent: %v", err)
+	}
+
+	other := newTestSSHServer(t, signer.PublicKey())
+	err = ping(&sshTunnelConfig{Host: server.addr, User: "deploy", PrivateKey: key, KnownHostsFile: other.knownHosts})
+	if err == nil || !strings.Contains(err.Error(), "knownhosts: key is unknown") {
+		t.Errorf("got error %v for an unknown host key", err)
+	}
+}
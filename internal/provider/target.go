@@ -0,0 +1,278 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// resolveSchema is the resolve attribute of the provider, an endpoint or a data source
+func resolveSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeMap,
+		Optional: true,
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+		ValidateDiagFunc: validateResolve,
+		Description:      "host:port to comma separated IPs to connect to instead of resolving the host, like curl --resolve.",
+	}
+}
+
+// dialTarget is a parsed gRPC naming target, see
+// https://github.com/grpc/grpc/blob/master/doc/naming.md
+type dialTarget struct {
+	raw     string
+	network string
+	// addrs are tried in order until one connects
+	addrs []string
+	// lookup resolves the host of addrs[0] at dial time and tries every A and AAAA record
+	lookup bool
+	// resolved is set when a resolve entry replaced the addresses
+	resolved  bool
+	dnsServer string
+	// authority is the default :authority for calls to the target
+	authority string
+	// proxy is the configured proxy, without one HTTPS_PROXY and NO_PROXY apply
+	proxy *url.URL
+	// proxyCA is trusted for an https proxy instead of the system roots
+	proxyCA string
+	// tunnel, when set, opens every connection through an SSH jump host instead
+	tunnel *sshTunnel
+}
+
+// parseTarget accepts host:port, unix:path, unix:///path, unix-abstract:name,
+// dns:[//server/]host[:port], ipv4:addr[:port][,...] and ipv6:addr[,...]
+func parseTarget(target string) (*dialTarget, error) {
+	t := &dialTarget{raw: target, network: "tcp"}
+	scheme, rest, found := strings.Cut(target, ":")
+	switch {
+	case found && scheme == "unix":
+		path := rest
+		if strings.HasPrefix(rest, "//") {
+			path = strings.TrimPrefix(rest, "//")
+			if !strings.HasPrefix(path, "/") {
+				return nil, fmt.Errorf("target %q must be unix:///absolute/path or unix:relative/path", target)
+			}
+		}
+		if path == "" {
+			return nil, fmt.Errorf("target %q has no socket path", target)
+		}
+		t.network, t.addrs, t.authority = "unix", []string{path}, "localhost"
+	case found && scheme == "unix-abstract":
+		if rest == "" {
+			return nil, fmt.Errorf("target %q has no socket name", target)
+		}
+		// Go dials abstract sockets with a leading @
+		t.network, t.addrs, t.authority = "unix", []string{"@" + rest}, "localhost"
+	case found && scheme == "dns":
+		hostport := rest
+		if strings.HasPrefix(rest, "//") {
+			var server string
+			server, hostport, _ = strings.Cut(strings.TrimPrefix(rest, "//"), "/")
+			if server != "" {
+				if _, _, err := net.SplitHostPort(server); err != nil {
+					server = net.JoinHostPort(server, "53")
+				}
+				t.dnsServer = server
+			}
+		}
+		addr, err := withDefaultPort(hostport)
+		if err != nil {
+			return nil, fmt.Errorf("target %q: %v", target, err)
+		}
+		t.addrs, t.lookup, t.authority = []string{addr}, true, hostport
+	case found && (scheme == "ipv4" || scheme == "ipv6"):
+		for _, a := range strings.Split(rest, ",") {
+			addr, err := withDefaultPort(a)
+			if err != nil {
+				return nil, fmt.Errorf("target %q: %v", target, err)
+			}
+			host, _, _ := net.SplitHostPort(addr)
+			ip := net.ParseIP(host)
+			if ip == nil || (ip.To4() != nil) != (scheme == "ipv4") {
+				return nil, fmt.Errorf("target %q: %q is not an %s address", target, a, scheme)
+			}
+			t.addrs = append(t.addrs, addr)
+		}
+		t.authority = t.addrs[0]
+	default:
+		host, port, err := net.SplitHostPort(target)
+		if err != nil || host == "" || port == "" || strings.Contains(target, "/") {
+			return nil, fmt.Errorf("target %q must be host:port or a unix:, unix-abstract:, dns:, ipv4: or ipv6: target", target)
+		}
+		t.addrs, t.authority = []string{target}, target
+	}
+	return t, nil
+}
+
+// withDefaultPort adds port 443 to a host or ipv6 address without one
+func withDefaultPort(hostport string) (string, error) {
+	if hostport == "" {
+		return "", fmt.Errorf("no host")
+	}
+	if _, _, err := net.SplitHostPort(hostport); err == nil {
+		return hostport, nil
+	}
+	host := strings.Trim(hostport, "[]")
+	if strings.ContainsAny(host, "[]/") {
+		return "", fmt.Errorf("%q is not a host[:port]", hostport)
+	}
+	return net.JoinHostPort(host, "443"), nil
+}
+
+// withResolve returns the target with its host:port replaced by the resolve
+// entry for it, like curl --resolve; the entry is a comma separated list of IPs
+func (t *dialTarget) withResolve(resolve map[string]string) (*dialTarget, error) {
+	if t.network != "tcp" || len(t.addrs) != 1 {
+		return t, nil
+	}
+	override, ok := resolve[resolveKey(t.addrs[0])]
+	if !ok {
+		return t, nil
+	}
+	ips, err := resolveIPs(override)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %q: %v", t.addrs[0], err)
+	}
+	_, port, _ := net.SplitHostPort(t.addrs[0])
+	resolved := *t
+	resolved.addrs, resolved.lookup, resolved.resolved = nil, false, true
+	for _, ip := range ips {
+		resolved.addrs = append(resolved.addrs, net.JoinHostPort(ip.String(), port))
+	}
+	return &resolved, nil
+}
+
+// resolveKey is the form resolve entries are stored and looked up in: the host
+// lowercased without a trailing dot, as DNS names are case insensitive and
+// absolute, an IP host in its canonical form, and the port as written
+func resolveKey(hostport string) string {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return strings.ToLower(hostport)
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ip := net.ParseIP(host); ip != nil {
+		host = ip.String()
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// mergeResolve layers resolve entries over defaults, an entry replacing the
+// default for the same resolveKey, eg Billing.internal.:443 replaces billing.internal:443
+func mergeResolve(defaults map[string]string, resolve map[string]interface{}) map[string]string {
+	merged := make(map[string]string, len(defaults)+len(resolve))
+	for hostport, ips := range defaults {
+		merged[resolveKey(hostport)] = ips
+	}
+	for hostport, ips := range resolve {
+		merged[resolveKey(hostport)] = ips.(string)
+	}
+	return merged
+}
+
+// resolveIPs parses a resolve entry, a comma separated list of IPs
+func resolveIPs(value string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, a := range strings.Split(value, ",") {
+		ip := net.ParseIP(strings.Trim(strings.TrimSpace(a), "[]"))
+		if ip == nil {
+			return nil, fmt.Errorf("%q is not an IP address", a)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// key is the part of the transportKey that decides where connections go
+func (t *dialTarget) key() string {
+	proxy, tunnel := "", ""
+	if t.proxy != nil {
+		proxy = t.proxy.String()
+	}
+	if t.tunnel != nil {
+		tunnel = t.tunnel.config.key()
+	}
+	return fmt.Sprintf("%s %s %q %t %s %q %q %q", t.raw, t.network, t.addrs, t.lookup, t.dnsServer, proxy, t.proxyCA, tunnel)
+}
+
+// dial connects to the first address of the target that accepts
+func (t *dialTarget) dial(ctx context.Context) (net.Conn, error) {
+	addrs := t.addrs
+	if t.lookup && t.tunnel == nil {
+		// a proxy or the jump host resolves the host itself
+		if p, err := t.proxyFor(addrs[0]); err != nil || p == nil {
+			if addrs, err = t.resolve(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var d net.Dialer
+	var errs []string
+	for _, addr := range addrs {
+		p, err := t.proxyFor(addr)
+		if err != nil {
+			return nil, err
+		}
+		var conn net.Conn
+		if t.tunnel != nil {
+			conn, err = t.tunnel.dial(ctx, t.network, addr)
+		} else if p != nil {
+			conn, err = dialProxy(ctx, p, addr, t.proxyCA)
+		} else {
+			conn, err = d.DialContext(ctx, t.network, addr)
+		}
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err.Error())
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 1 {
+		return nil, fmt.Errorf("%s", errs[0])
+	}
+	return nil, fmt.Errorf("no address of %s accepted the connection: %s", t.raw, strings.Join(errs, "; "))
+}
+
+// proxyFor is the proxy for addr, unix sockets and ssh tunnels are never proxied
+func (t *dialTarget) proxyFor(addr string) (*url.URL, error) {
+	if t.network != "tcp" || t.tunnel != nil {
+		return nil, nil
+	}
+	return proxyFor(t.proxy, addr)
+}
+
+// resolve looks up every A and AAAA record of a dns: target, IPv4 first
+func (t *dialTarget) resolve(ctx context.Context) ([]string, error) {
+	host, port, _ := net.SplitHostPort(t.addrs[0])
+	resolver := net.DefaultResolver
+	if t.dnsServer != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, t.dnsServer)
+			},
+		}
+	}
+	ips, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %v", t.raw, err)
+	}
+	sort.SliceStable(ips, func(i, j int) bool {
+		return ips[i].IP.To4() != nil && ips[j].IP.To4() == nil
+	})
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+	return addrs, nil
+}
@@ -0,0 +1,148 @@
+package provider
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		target    string
+		network   string
+		addrs     []string
+		lookup    bool
+		dnsServer string
+		authority string
+	}{
+		{"localhost:50051", "tcp", []string{"localhost:50051"}, false, "", "localhost:50051"},
+		{"[::1]:443", "tcp", []string{"[::1]:443"}, false, "", "[::1]:443"},
+		{"unix:///run/agent.sock", "unix", []string{"/run/agent.sock"}, false, "", "localhost"},
+		{"unix:agent.sock", "unix", []string{"agent.sock"}, false, "", "localhost"},
+		{"unix-abstract:agent", "unix", []string{"@agent"}, false, "", "localhost"},
+		{"dns:///billing.internal:8443", "tcp", []string{"billing.internal:8443"}, true, "", "billing.internal:8443"},
+		{"dns:billing.internal", "tcp", []string{"billing.internal:443"}, true, "", "billing.internal"},
+		{"dns://8.8.8.8/billing.internal:8443", "tcp", []string{"billing.internal:8443"}, true, "8.8.8.8:53", "billing.internal:8443"},
+		{"ipv4:10.0.0.1:8443,10.0.0.2", "tcp", []string{"10.0.0.1:8443", "10.0.0.2:443"}, false, "", "10.0.0.1:8443"},
+		{"ipv6:[::1]:8443,::2", "tcp", []string{"[::1]:8443", "[::2]:443"}, false, "", "[::1]:8443"},
+	}
+	for _, tc := range tests {
+		got, err := parseTarget(tc.target)
+		if err != nil {
+			t.Errorf("parseTarget(%q): %v", tc.target, err)
+			continue
+		}
+		if got.network != tc.network || strings.Join(got.addrs, ",") != strings.Join(tc.addrs, ",") || got.lookup != tc.lookup || got.dnsServer != tc.dnsServer || got.authority != tc.authority {
+			t.Errorf("parseTarget(%q) = %+v", tc.target, got)
+		}
+	}
+
+	for _, target := range []string{"localhost", "https://localhost:443", "unix://agent.sock", "unix:", "unix-abstract:", "dns:///", "ipv4:::1", "ipv6:10.0.0.1", "ipv4:10.0.0.1,"} {
+		if _, err := parseTarget(target); err == nil {
+			t.Errorf("parseTarget(%q): expected an error", target)
+		}
+	}
+}
+
+func TestWithResolve(t *testing.T) {
+	target, err := parseTarget("dns:///Backend.test:8443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := target.withResolve(map[string]string{"backend.test:8443": "10.0.0.1, ::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.lookup || strings.Join(got.addrs, ",") != "10.0.0.1:8443,[::1]:8443" || got.authority != "Backend.test:8443" {
+		t.Errorf("withResolve = %+v", got)
+	}
+	if got.key() == target.key() {
+		t.Error("a resolved target shares the transport key of the unresolved one")
+	}
+
+	// other ports and unix sockets are left alone
+	if got, _ := target.withResolve(map[string]string{"backend.test:443": "10.0.0.1"}); got != target {
+		t.Errorf("resolve for another port applied: %+v", got)
+	}
+	if _, err := target.withResolve(map[string]string{"backend.test:8443": "backend-1"}); err == nil {
+		t.Error("expected an error for a host name in resolve")
+	}
+}
+
+func TestMergeResolve(t *testing.T) {
+	got := mergeResolve(
+		map[string]string{"Billing.internal:443": "10.0.0.1", "[0:0::1]:8443": "10.0.0.2", "ledger.internal:443": "10.0.0.3"},
+		map[string]interface{}{"billing.INTERNAL.:443": "10.0.1.1", "[::1]:8443": "10.0.1.2"},
+	)
+	want := map[string]string{"billing.internal:443": "10.0.1.1", "[::1]:8443": "10.0.1.2", "ledger.internal:443": "10.0.0.3"}
+	if len(got) != len(want) {
+		t.Fatalf("mergeResolve() = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("mergeResolve()[%q] = %q, want %q", k, got[k], v)
+		}
+	}
+
+	// targets are looked up by the same key
+	target, err := parseTarget("[0::1]:8443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved, err := target.withResolve(got); err != nil || strings.Join(resolved.addrs, ",") != "10.0.1.2:8443" {
+		t.Errorf("withResolve = %+v, %v", resolved, err)
+	}
+}
+
+func TestDialTarget(t *testing.T) {
+	dir, err := os.MkdirTemp("", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	unix, err := net.Listen("unix", filepath.Join(dir, "agent.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close()
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	// a port nothing listens on
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	_, port, _ := net.SplitHostPort(tcp.Addr().String())
+	for _, target := range []string{
+		"unix://" + filepath.Join(dir, "agent.sock"),
+		"ipv4:" + closed.Addr().String() + "," + tcp.Addr().String(),
+		"dns:///localhost:" + port,
+	} {
+		dt, err := parseTarget(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := dt.dial(context.Background())
+		if err != nil {
+			t.Errorf("dialing %s: %v", target, err)
+			continue
+		}
+		conn.Close()
+	}
+
+	dt, err := parseTarget("ipv4:" + closed.Addr().String() + "," + closed.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dt.dial(context.Background()); err == nil || !strings.Contains(err.Error(), "no address of ipv4:") {
+		t.Errorf("got error %v when every address is closed", err)
+	}
+}
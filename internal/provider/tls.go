@@ -0,0 +1,316 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// tlsVersions are the accepted min_tls_version and max_tls_version values
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func tlsVersionNames() []string {
+	names := make([]string, 0, len(tlsVersions))
+	for name := range tlsVersions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func cipherSuiteNames() []string {
+	var names []string
+	for _, s := range tls.CipherSuites() {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// withTLSSchema adds the trust and TLS version attributes shared by the
+// provider, endpoints and data sources to s
+func withTLSSchema(s map[string]*schema.Schema) map[string]*schema.Schema {
+	for k, v := range map[string]*schema.Schema{
+		"ca_files": {
+			Type:     schema.TypeList,
+			Optional: true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+			Description: "Files with PEM encoded CAs, trusted in addition to ca.",
+		},
+		"use_system_roots": {
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Description: "Trust the system roots as well as ca and ca_files.",
+		},
+		"crl_files": {
+			Type:     schema.TypeList,
+			Optional: true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+			Description: "PEM or DER CRL files the server chain is checked against.",
+		},
+		"min_tls_version": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: validation.StringInSlice(tlsVersionNames(), false),
+		},
+		"max_tls_version": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: validation.StringInSlice(tlsVersionNames(), false),
+		},
+		"cipher_suites": {
+			Type:     schema.TypeList,
+			Optional: true,
+			Elem: &schema.Schema{
+				Type:         schema.TypeString,
+				ValidateFunc: validation.StringInSlice(cipherSuiteNames(), false),
+			},
+			Description: "TLS 1.0 to 1.2 cipher suites offered, TLS 1.3 suites are not configurable.",
+		},
+	} {
+		s[k] = v
+	}
+	return s
+}
+
+// tlsSettings are the trust and TLS version settings besides ca
+type tlsSettings struct {
+	CAFiles        []string
+	UseSystemRoots bool
+	CRLFiles       []string
+	MinVersion     string
+	MaxVersion     string
+	CipherSuites   []string
+}
+
+// tlsSettingsGetter reads a setting of the provider, an endpoint block or a
+// data source, ok only when it is set in the configuration
+type tlsSettingsGetter func(key string) (interface{}, bool)
+
+// configGetter reads the settings of d under prefix, eg "endpoint.0."; unlike
+// GetOk it reports an explicit false as set so it can turn a default off
+func configGetter(d *schema.ResourceData, prefix string) tlsSettingsGetter {
+	return func(key string) (interface{}, bool) {
+		return d.GetOkExists(prefix + key)
+	}
+}
+
+// overlay returns s with every setting get has a value for replaced
+func (s tlsSettings) overlay(get tlsSettingsGetter) tlsSettings {
+	if v, ok := get("ca_files"); ok && len(v.([]interface{})) > 0 {
+		s.CAFiles = stringList(v)
+	}
+	if v, ok := get("use_system_roots"); ok {
+		s.UseSystemRoots = v.(bool)
+	}
+	if v, ok := get("crl_files"); ok && len(v.([]interface{})) > 0 {
+		s.CRLFiles = stringList(v)
+	}
+	if v, ok := get("min_tls_version"); ok && v.(string) != "" {
+		s.MinVersion = v.(string)
+	}
+	if v, ok := get("max_tls_version"); ok && v.(string) != "" {
+		s.MaxVersion = v.(string)
+	}
+	if v, ok := get("cipher_suites"); ok && len(v.([]interface{})) > 0 {
+		s.CipherSuites = stringList(v)
+	}
+	return s
+}
+
+// key is the part of the transportKey that depends on the settings
+func (s tlsSettings) key() string {
+	return fmt.Sprintf("%q %t %q %q %q %q", s.CAFiles, s.UseSystemRoots, s.CRLFiles, s.MinVersion, s.MaxVersion, s.CipherSuites)
+}
+
+// apply sets the roots, versions and cipher suites of cfg from ca and s
+func (s tlsSettings) apply(cfg *tls.Config, ca string) error {
+	if ca != "" || len(s.CAFiles) > 0 || s.UseSystemRoots {
+		roots, err := loadRoots(ca, s.CAFiles, s.UseSystemRoots)
+		if err != nil {
+			return err
+		}
+		cfg.RootCAs = roots
+	}
+
+	if s.MinVersion != "" {
+		cfg.MinVersion = tlsVersions[s.MinVersion]
+	}
+	if s.MaxVersion != "" {
+		cfg.MaxVersion = tlsVersions[s.MaxVersion]
+	}
+	if cfg.MinVersion != 0 && cfg.MaxVersion != 0 && cfg.MinVersion > cfg.MaxVersion {
+		return fmt.Errorf("min_tls_version %s is above max_tls_version %s", s.MinVersion, s.MaxVersion)
+	}
+
+	for _, name := range s.CipherSuites {
+		for _, suite := range tls.CipherSuites() {
+			if suite.Name == name {
+				cfg.CipherSuites = append(cfg.CipherSuites, suite.ID)
+			}
+		}
+	}
+
+	if len(s.CRLFiles) > 0 {
+		crls, err := loadCRLs(s.CRLFiles)
+		if err != nil {
+			return err
+		}
+		cfg.VerifyConnection = chainVerifyConnection(cfg.VerifyConnection, verifyCRLs(crls))
+	}
+	return nil
+}
+
+// loadRoots builds the root pool from ca, the ca_files and optionally the system roots
+func loadRoots(ca string, files []string, system bool) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if system {
+		var err error
+		if pool, err = x509.SystemCertPool(); err != nil {
+			return nil, fmt.Errorf("loading the system roots: %v", err)
+		}
+	}
+	if ca != "" {
+		if err := appendPEMCerts(pool, []byte(ca)); err != nil {
+			return nil, fmt.Errorf("ca %v", err)
+		}
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca_files: %v", err)
+		}
+		if err := appendPEMCerts(pool, b); err != nil {
+			return nil, fmt.Errorf("ca_files %s %v", f, err)
+		}
+	}
+	return pool, nil
+}
+
+// appendPEMCerts adds every certificate of one or more concatenated PEM
+// bundles to pool; unlike AppendCertsFromPEM a certificate that does not
+// parse is an error rather than skipped
+func appendPEMCerts(pool *x509.CertPool, b []byte) error {
+	n := 0
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		n++
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("certificate %d: %v", n, err)
+		}
+		pool.AddCert(cert)
+	}
+	if n == 0 {
+		return fmt.Errorf("does not contain a PEM encoded certificate")
+	}
+	return nil
+}
+
+// namedCRL is a parsed CRL and the file it came from
+type namedCRL struct {
+	file string
+	crl  *x509.RevocationList
+}
+
+// loadCRLs reads PEM or DER encoded CRL files
+func loadCRLs(files []string) ([]namedCRL, error) {
+	var crls []namedCRL
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading crl_files: %v", err)
+		}
+		ders := [][]byte{b}
+		if strings.Contains(string(b), "-----BEGIN") {
+			ders = nil
+			for block, rest := pem.Decode(b); block != nil; block, rest = pem.Decode(rest) {
+				if block.Type == "X509 CRL" {
+					ders = append(ders, block.Bytes)
+				}
+			}
+			if len(ders) == 0 {
+				return nil, fmt.Errorf("crl_files %s does not contain a PEM encoded X509 CRL", f)
+			}
+		}
+		for _, der := range ders {
+			crl, err := x509.ParseRevocationList(der)
+			if err != nil {
+				return nil, fmt.Errorf("parsing crl_files %s: %v", f, err)
+			}
+			if !crl.NextUpdate.IsZero() && crl.NextUpdate.Before(time.Now()) {
+				log.Printf("[WARN] CRL %s from %s is past its next update %s", f, crl.Issuer, crl.NextUpdate)
+			}
+			crls = append(crls, namedCRL{file: f, crl: crl})
+		}
+	}
+	return crls, nil
+}
+
+// verifyCRLs returns a VerifyConnection callback that fails when a certificate
+// of the server chain is revoked by a CRL signed by its issuer
+func verifyCRLs(crls []namedCRL) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		chains := cs.VerifiedChains
+		if len(chains) == 0 {
+			// insecure_skip_verify, check the chain as sent
+			chains = [][]*x509.Certificate{cs.PeerCertificates}
+		}
+		for _, chain := range chains {
+			for i := 0; i+1 < len(chain); i++ {
+				cert, issuer := chain[i], chain[i+1]
+				for _, c := range crls {
+					if c.crl.CheckSignatureFrom(issuer) != nil {
+						continue
+					}
+					for _, revoked := range c.crl.RevokedCertificateEntries {
+						if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+							return fmt.Errorf("server certificate %s serial %s is revoked by %s", cert.Subject, cert.SerialNumber, c.file)
+						}
+					}
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// chainVerifyConnection runs both callbacks, either may be nil
+func chainVerifyConnection(first, second func(tls.ConnectionState) error) func(tls.ConnectionState) error {
+	if first == nil {
+		return second
+	}
+	if second == nil {
+		return first
+	}
+	return func(cs tls.ConnectionState) error {
+		if err := first(cs); err != nil {
+			return err
+		}
+		return second(cs)
+	}
+}
@@ -0,0 +1,187 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+func writeTestFile(t *testing.T, name string, b []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRoots(t *testing.T) {
+	ca := strings.Replace(caCert, `\n`, "\n", -1)
+	caFile := writeTestFile(t, "root-ca.crt", []byte(ca))
+	notPEM := writeTestFile(t, "root-ca.der", []byte("not a certificate"))
+
+	if _, err := loadRoots(ca, []string{caFile}, false); err != nil {
+		t.Errorf("ca and ca_files: %v", err)
+	}
+	if _, err := loadRoots(ca, nil, true); err != nil {
+		t.Errorf("ca and system roots: %v", err)
+	}
+	if _, err := loadRoots(`-----BEGIN CERTIFICATE-----\nMIID`, nil, false); err == nil || err.Error() != "ca does not contain a PEM encoded certificate" {
+		t.Errorf("got error %v for a broken ca", err)
+	}
+	if _, err := loadRoots("", []string{caFile, notPEM}, false); err == nil || !strings.Contains(err.Error(), "ca_files "+notPEM) {
+		t.Errorf("got error %v for a ca_files entry without PEM", err)
+	}
+	if _, err := loadRoots("", []string{filepath.Join(t.TempDir(), "missing.crt")}, false); err == nil {
+		t.Error("expected an error for a missing ca_files entry")
+	}
+
+	// ca holds several concatenated bundles, all of them trusted
+	td := newTestTrustDomain(t)
+	roots, err := loadRoots(ca+"\n"+string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: td.cert.Raw})), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, localhost := testLocalhostPin(t)
+	for _, c := range []*x509.Certificate{localhost, td.cert} {
+		if _, err := c.Verify(x509.VerifyOptions{Roots: roots}); err != nil {
+			t.Errorf("%s not trusted by the ca bundle: %v", c.Subject, err)
+		}
+	}
+	// a certificate that does not parse is reported instead of skipped
+	broken := ca + "\n-----BEGIN CERTIFICATE-----\nMIID\n-----END CERTIFICATE-----\n"
+	if _, err := loadRoots(broken, nil, false); err == nil || !strings.HasPrefix(err.Error(), "ca certificate 2: ") {
+		t.Errorf("got error %v for a bundle with a broken certificate", err)
+	}
+}
+
+// mapGetter reads settings from a map, every key in it counting as set
+func mapGetter(m map[string]interface{}) tlsSettingsGetter {
+	return func(key string) (interface{}, bool) {
+		v, ok := m[key]
+		return v, ok
+	}
+}
+
+func TestTLSSettingsApply(t *testing.T) {
+	cfg := &tls.Config{}
+	s := tlsSettings{MinVersion: "1.2", MaxVersion: "1.3", CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}}
+	if err := s.apply(cfg, ""); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS12 || cfg.MaxVersion != tls.VersionTLS13 || cfg.RootCAs != nil {
+		t.Errorf("got config %+v", cfg)
+	}
+	if len(cfg.CipherSuites) != 1 || cfg.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("cipher suites = %v", cfg.CipherSuites)
+	}
+
+	s = tlsSettings{MinVersion: "1.3", MaxVersion: "1.2"}
+	if err := s.apply(&tls.Config{}, ""); err == nil || !strings.Contains(err.Error(), "min_tls_version 1.3 is above max_tls_version 1.2") {
+		t.Errorf("got error %v for min above max", err)
+	}
+
+	// endpoint blocks replace only what they set
+	base := tlsSettings{MinVersion: "1.2", CAFiles: []string{"a.crt"}}
+	got := base.overlay(mapGetter(map[string]interface{}{
+		"ca_files":         []interface{}{},
+		"use_system_roots": true,
+		"crl_files":        []interface{}{"b.crl"},
+		"min_tls_version":  "",
+		"max_tls_version":  "1.3",
+		"cipher_suites":    []interface{}{},
+	}))
+	want := tlsSettings{MinVersion: "1.2", MaxVersion: "1.3", CAFiles: []string{"a.crt"}, UseSystemRoots: true, CRLFiles: []string{"b.crl"}}
+	if got.key() != want.key() {
+		t.Errorf("overlay = %+v, want %+v", got, want)
+	}
+}
+
+func TestVerifyCRLs(t *testing.T) {
+	td := newTestTrustDomain(t)
+	other := newTestTrustDomain(t)
+	revoked := td.issue(t, "spiffe://example.org/revoked", false)
+	good := td.issue(t, "spiffe://example.org/good", false)
+
+	crl := func(issuer *testTrustDomain, cert *testSVID) []byte {
+		der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+			Number:     big.NewInt(1),
+			ThisUpdate: time.Now().Add(-time.Minute),
+			NextUpdate: time.Now().Add(time.Hour),
+			RevokedCertificateEntries: []x509.RevocationListEntry{
+				{SerialNumber: cert.cert.SerialNumber, RevocationTime: time.Now()},
+			},
+		}, issuer.cert, issuer.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+	pemFile := writeTestFile(t, "ca.crl", pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl(td, revoked)}))
+	// the same serial revoked by a CA that did not issue it
+	derFile := writeTestFile(t, "other.crl", crl(other, good))
+
+	crls, err := loadCRLs([]string{pemFile, derFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := verifyCRLs(crls)
+	if err := verify(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{good.cert, td.cert}}}); err != nil {
+		t.Errorf("good certificate: %v", err)
+	}
+	err = verify(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{revoked.cert, td.cert}}})
+	if err == nil || !strings.Contains(err.Error(), "is revoked by "+pemFile) {
+		t.Errorf("got error %v for a revoked certificate", err)
+	}
+	// with insecure_skip_verify the chain as sent is checked
+	if err := verify(tls.ConnectionState{PeerCertificates: []*x509.Certificate{revoked.cert, td.cert}}); err == nil {
+		t.Error("expected an error for a revoked certificate without verified chains")
+	}
+
+	notCRL := writeTestFile(t, "cert.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: good.cert.Raw}))
+	if _, err := loadCRLs([]string{notCRL}); err == nil || !strings.Contains(err.Error(), "does not contain a PEM encoded X509 CRL") {
+		t.Errorf("got error %v for a certificate in crl_files", err)
+	}
+}
+
+func TestDialRequiresH2(t *testing.T) {
+	td := newTestTrustDomain(t)
+	server := td.issue(t, "spiffe://example.org/echo", false)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate()},
+		NextProtos:   []string{"http/1.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	target, err := parseTarget(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &connPool{t: &http2.Transport{}, target: target, tls: &tls.Config{InsecureSkipVerify: true, NextProtos: []string{http2.NextProtoTLS, "http/1.1"}}}
+	_, err = p.dial(context.Background(), l.Addr().String())
+	if err == nil || !strings.Contains(err.Error(), `did not negotiate "h2" with ALPN (got "http/1.1")`) {
+		t.Errorf("got error %v from a server without h2", err)
+	}
+}
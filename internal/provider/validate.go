@@ -0,0 +1,319 @@
+package provider
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// validateRegistryFile checks that a registry_files entry is a base64 encoded FileDescriptorSet
+func validateRegistryFile(v interface{}, path cty.Path) diag.Diagnostics {
+	fc, ok := v.(string)
+	if !ok {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Expected a base64 encoded descriptor set",
+			AttributePath: path,
+		}}
+	}
+	_, err := parseRegistryFile(fc)
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid registry file",
+			Detail:        err.Error(),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
+
+// parseRegistryFile decodes one registry_files entry
+func parseRegistryFile(fc string) (*descriptorpb.FileDescriptorSet, error) {
+	fileContent, err := base64.StdEncoding.DecodeString(fc)
+	if err != nil {
+		return nil, fmt.Errorf("registry files must be base64 encoded, eg with filebase64(): %v", err)
+	}
+	fileDescriptors := &descriptorpb.FileDescriptorSet{}
+	err = proto.Unmarshal(fileContent, fileDescriptors)
+	if err != nil {
+		return nil, fmt.Errorf("not a FileDescriptorSet, compile it with protoc --descriptor_set_out: %v", err)
+	}
+	return fileDescriptors, nil
+}
+
+// validateMessageName checks request_type and response_type are fully qualified message names
+func validateMessageName(v interface{}, path cty.Path) diag.Diagnostics {
+	name, ok := v.(string)
+	if !ok || name == "" {
+		return nil
+	}
+	if !protoreflect.FullName(name).IsValid() {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid message name",
+			Detail:        fmt.Sprintf("%q is not a fully qualified protobuf message name like \"echo.EchoRequest\"", name),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
+
+// findMessageType looks up the message type named by attr once the registry_files are loaded
+func findMessageType(attr string, summary string, name string) (protoreflect.MessageType, diag.Diagnostics) {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(name))
+	if err != nil || mt == nil {
+		detail := fmt.Sprintf("message %q was not found in registry_files", name)
+		if d, derr := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name)); derr == nil {
+			detail = fmt.Sprintf("%q is a %T, not a top level message", name, d)
+		}
+		return nil, diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       summary,
+			Detail:        detail,
+			AttributePath: cty.GetAttrPath(attr),
+		}}
+	}
+	return mt, nil
+}
+
+// jsonFieldError is a problem with one field of a json request_body
+type jsonFieldError struct {
+	Path    string
+	Message string
+}
+
+func (e jsonFieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// checkJSONBody walks a protojson request_body against md and reports every
+// field that protojson would reject, keyed by its json path
+func checkJSONBody(body string, md protoreflect.MessageDescriptor) []jsonFieldError {
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	if err != nil {
+		return []jsonFieldError{{Path: "$", Message: fmt.Sprintf("invalid json: %v", err)}}
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return []jsonFieldError{{Path: "$", Message: "expected a json object"}}
+	}
+
+	var errs []jsonFieldError
+	t, ok := obj["@type"]
+	if !ok {
+		errs = append(errs, jsonFieldError{Path: "$", Message: fmt.Sprintf("missing \"@type\", set it to %q", md.FullName())})
+	} else if ts, isString := t.(string); !isString || ts[strings.LastIndex(ts, "/")+1:] != string(md.FullName()) {
+		errs = append(errs, jsonFieldError{Path: "$.@type", Message: fmt.Sprintf("%v does not match request_type %q", t, md.FullName())})
+	}
+	delete(obj, "@type")
+	checkJSONMessage(&errs, "$", obj, md)
+	return errs
+}
+
+func checkJSONMessage(errs *[]jsonFieldError, path string, v interface{}, md protoreflect.MessageDescriptor) {
+	if isWellKnownJSONType(md) {
+		// well known types have their own json mapping; leave those to protojson
+		return
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		*errs = append(*errs, jsonFieldError{Path: path, Message: fmt.Sprintf("expected an object for message %s, got %s", md.FullName(), jsonKind(v))})
+		return
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fieldPath := path + "." + k
+		fd := md.Fields().ByJSONName(k)
+		if fd == nil {
+			fd = md.Fields().ByName(protoreflect.Name(k))
+		}
+		if fd == nil {
+			*errs = append(*errs, jsonFieldError{Path: fieldPath, Message: fmt.Sprintf("unknown field %q in message %s", k, md.FullName())})
+			continue
+		}
+		checkJSONField(errs, fieldPath, obj[k], fd)
+	}
+}
+
+func checkJSONField(errs *[]jsonFieldError, path string, v interface{}, fd protoreflect.FieldDescriptor) {
+	if v == nil {
+		return
+	}
+	switch {
+	case fd.IsMap():
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			*errs = append(*errs, jsonFieldError{Path: path, Message: fmt.Sprintf("expected an object for map field %q, got %s", fd.Name(), jsonKind(v))})
+			return
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			checkJSONValue(errs, fmt.Sprintf("%s[%q]", path, k), obj[k], fd.MapValue())
+		}
+	case fd.IsList():
+		l, ok := v.([]interface{})
+		if !ok {
+			*errs = append(*errs, jsonFieldError{Path: path, Message: fmt.Sprintf("expected an array for repeated field %q, got %s", fd.Name(), jsonKind(v))})
+			return
+		}
+		for i, e := range l {
+			checkJSONValue(errs, fmt.Sprintf("%s[%d]", path, i), e, fd)
+		}
+	default:
+		checkJSONValue(errs, path, v, fd)
+	}
+}
+
+func checkJSONValue(errs *[]jsonFieldError, path string, v interface{}, fd protoreflect.FieldDescriptor) {
+	problem := ""
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if v != nil {
+			checkJSONMessage(errs, path, v, fd.Message())
+		}
+		return
+	case protoreflect.EnumKind:
+		switch t := v.(type) {
+		case string:
+			if fd.Enum().Values().ByName(protoreflect.Name(t)) == nil {
+				names := make([]string, 0, fd.Enum().Values().Len())
+				for i := 0; i < fd.Enum().Values().Len(); i++ {
+					names = append(names, string(fd.Enum().Values().Get(i).Name()))
+				}
+				problem = fmt.Sprintf("invalid value %q for enum %s, expected one of %s", t, fd.Enum().FullName(), strings.Join(names, ", "))
+			}
+		case json.Number:
+			if _, err := strconv.ParseInt(t.String(), 10, 32); err != nil {
+				problem = fmt.Sprintf("invalid number %s for enum %s", t, fd.Enum().FullName())
+			}
+		case nil:
+			if fd.Enum().FullName() != "google.protobuf.NullValue" {
+				problem = fmt.Sprintf("null is not a value of enum %s", fd.Enum().FullName())
+			}
+		default:
+			problem = fmt.Sprintf("expected a string or number for enum %s, got %s", fd.Enum().FullName(), jsonKind(v))
+		}
+	case protoreflect.BoolKind:
+		if _, ok := v.(bool); !ok {
+			problem = fmt.Sprintf("expected a bool, got %s", jsonKind(v))
+		}
+	case protoreflect.StringKind:
+		if _, ok := v.(string); !ok {
+			problem = fmt.Sprintf("expected a string, got %s", jsonKind(v))
+		}
+	case protoreflect.BytesKind:
+		s, ok := v.(string)
+		if !ok {
+			problem = fmt.Sprintf("expected a base64 string, got %s", jsonKind(v))
+		} else if !isBase64(s) {
+			problem = "invalid base64 for bytes field"
+		}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		s, ok := jsonNumberString(v)
+		if !ok {
+			problem = fmt.Sprintf("expected a number, got %s", jsonKind(v))
+		} else if s != "NaN" && s != "Infinity" && s != "-Infinity" {
+			if _, err := strconv.ParseFloat(s, 64); err != nil {
+				problem = fmt.Sprintf("invalid number %q", s)
+			}
+		}
+	default:
+		s, ok := jsonNumberString(v)
+		if !ok {
+			problem = fmt.Sprintf("expected an integer, got %s", jsonKind(v))
+		} else {
+			problem = checkJSONInteger(s, fd.Kind())
+		}
+	}
+	if problem != "" {
+		*errs = append(*errs, jsonFieldError{Path: path, Message: fmt.Sprintf("field %q: %s", fd.Name(), problem)})
+	}
+}
+
+// checkJSONInteger checks s fits the integer kind; protojson accepts integral
+// values written with exponents or fractions, eg 1e3 or 2.0
+func checkJSONInteger(s string, kind protoreflect.Kind) string {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Sprintf("invalid integer %q", s)
+	}
+	if f != math.Trunc(f) {
+		return fmt.Sprintf("%s is not an integer", s)
+	}
+	var lo, hi float64
+	switch kind {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		lo, hi = math.MinInt32, math.MaxInt32
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		lo, hi = 0, math.MaxUint32
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		lo, hi = 0, math.MaxUint64
+	default:
+		lo, hi = math.MinInt64, math.MaxInt64
+	}
+	if f < lo || f > hi {
+		return fmt.Sprintf("%s is out of range for %s", s, kind)
+	}
+	return ""
+}
+
+func jsonNumberString(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case json.Number:
+		return t.String(), true
+	case string:
+		// 64bit integers and the non finite floats are written as strings
+		return t, true
+	}
+	return "", false
+}
+
+func isBase64(s string) bool {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if _, err := enc.DecodeString(s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a bool"
+	case json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-cty/cty"
+	echo "github.com/salrashid123/grpc_wireformat/grpc_services/src/echo"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestCheckJSONBody(t *testing.T) {
+	echoRequest := (&echo.EchoRequest{}).ProtoReflect().Descriptor()
+	// FieldDescriptorProto has enum, int32 and nested message fields to check against
+	fieldProto := (&descriptorpb.FieldDescriptorProto{}).ProtoReflect().Descriptor()
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "valid",
+			body: `{"@type": "echo.EchoRequest", "firstName": "sal", "last_name": "mander", "middle_name": {"name": "a"}}`,
+		},
+		{
+			name: "type url",
+			body: `{"@type": "type.googleapis.com/echo.EchoRequest", "first_name": "sal"}`,
+		},
+		{
+			name: "misspelled fields",
+			body: `{"@type": "echo.EchoRequest", "frist_name": "sal", "middle_name": {"nme": "a"}}`,
+			want: []string{
+				`$.frist_name: unknown field "frist_name" in message echo.EchoRequest`,
+				`$.middle_name.nme: unknown field "nme" in message echo.Middle`,
+			},
+		},
+		{
+			name: "type mismatch",
+			body: `{"@type": "echo.EchoRequest", "first_name": 42, "middle_name": "a"}`,
+			want: []string{
+				`$.first_name: field "first_name": expected a string, got a number`,
+				`$.middle_name: expected an object for message echo.Middle, got a string`,
+			},
+		},
+		{
+			name: "missing type",
+			body: `{"first_name": "sal"}`,
+			want: []string{`$: missing "@type", set it to "echo.EchoRequest"`},
+		},
+		{
+			name: "wrong type",
+			body: `{"@type": "foo.EchoRequest"}`,
+			want: []string{`$.@type: foo.EchoRequest does not match request_type "echo.EchoRequest"`},
+		},
+		{
+			name: "invalid json",
+			body: `{"@type": "echo.EchoRequest",`,
+			want: []string{`$: invalid json: unexpected EOF`},
+		},
+	}
+	for _, tc := range tests {
+		got := checkJSONBody(tc.body, echoRequest)
+		assertFieldErrors(t, tc.name, got, tc.want)
+	}
+
+	got := checkJSONBody(`{"@type": "google.protobuf.FieldDescriptorProto", "type": "TYPE_STRNG", "number": 3000000000, "label": 1, "options": {"packed": "yes"}}`, fieldProto)
+	assertFieldErrors(t, "enum and integers", got, []string{
+		`$.number: field "number": 3000000000 is out of range for int32`,
+		`$.options.packed: field "packed": expected a bool, got a string`,
+		`$.type: field "type": invalid value "TYPE_STRNG" for enum google.protobuf.FieldDescriptorProto.Type, expected one of TYPE_DOUBLE, TYPE_FLOAT, TYPE_INT64, TYPE_UINT64, TYPE_INT32, TYPE_FIXED64, TYPE_FIXED32, TYPE_BOOL, TYPE_STRING, TYPE_GROUP, TYPE_MESSAGE, TYPE_BYTES, TYPE_UINT32, TYPE_ENUM, TYPE_SFIXED32, TYPE_SFIXED64, TYPE_SINT32, TYPE_SINT64`,
+	})
+}
+
+func assertFieldErrors(t *testing.T, name string, got []jsonFieldError, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: got %d errors %v, want %v", name, len(got), got, want)
+		return
+	}
+	for i := range want {
+		if got[i].Error() != want[i] {
+			t.Errorf("%s: error %d is %q, want %q", name, i, got[i].Error(), want[i])
+		}
+	}
+}
+
+func TestValidateMessageName(t *testing.T) {
+	path := cty.GetAttrPath("request_type")
+	if diags := validateMessageName("echo.EchoRequest", path); diags.HasError() {
+		t.Errorf("unexpected error %v", diags)
+	}
+	if diags := validateMessageName("/echo.EchoRequest", path); !diags.HasError() {
+		t.Error("expected an error for an invalid name")
+	}
+}